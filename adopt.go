@@ -0,0 +1,90 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kobolog/tesson/lib"
+	"gopkg.in/urfave/cli.v2"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	errNoAdoptSupport  = errors.New("runtime doesn't support adoption")
+	errNoLocateSupport = errors.New("topology can't map cpusets to units")
+)
+
+func adopt(c *cli.Context) error {
+	if !c.IsSet("group") || c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, "adopt")
+	}
+
+	a, ok := r.(tesson.Adopter)
+
+	if !ok {
+		return errNoAdoptSupport
+	}
+
+	loc, ok := t.(tesson.Locator)
+
+	if !ok {
+		return errNoLocateSupport
+	}
+
+	f, err := frontend(c)
+
+	if err != nil {
+		return err
+	}
+
+	group := c.String("group")
+
+	l, err := a.Adopt(group, c.Args().Slice(), loc, tesson.StopOptions{
+		Purge:   !c.Bool("keep"),
+		Timeout: 30 * time.Second,
+	})
+
+	log.Infof("group [%s]: %d shards adopted.", group, len(l))
+
+	// Shards adopted before a failure have replaced their originals already,
+	// so they're registered all the same. Stopped shards stay stopped, and
+	// are not registered.
+	var running []tesson.Shard
+
+	for _, s := range l {
+		if s.State == "running" {
+			running = append(running, s)
+		}
+	}
+
+	if f != nil && len(running) > 0 {
+		if ferr := f.CreateService(group, running); ferr != nil {
+			if err != nil {
+				log.Errorf("unable to adopt shards: %v.", err)
+			}
+
+			return ferr
+		}
+	}
+
+	return err
+}
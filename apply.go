@@ -0,0 +1,378 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kobolog/tesson/lib"
+	"gopkg.in/urfave/cli.v2"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func apply(c *cli.Context) error {
+	if !c.IsSet("file") && !c.IsSet("from-compose") {
+		return cli.ShowCommandHelp(c, "apply")
+	}
+
+	var (
+		l   []tesson.Spec
+		err error
+	)
+
+	switch {
+	case c.IsSet("file") && c.IsSet("from-compose"):
+		return errComposeWithSpec
+	case c.IsSet("file"):
+		l, err = specs(c.String("file"))
+	default:
+		var spec tesson.Spec
+
+		spec, err = fromCompose(c)
+		l = append(l, spec)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Names are checked up front, so that specs are either applied or
+	// rejected as a whole.
+	running, err := r.List()
+
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range l {
+		if err := tesson.CheckGroup(spec.Name, running); err != nil {
+			return fmt.Errorf("group [%s]: %v", spec.Name, err)
+		}
+	}
+
+	for _, spec := range l {
+		// Groups are looked up once they're locked, so that the daemon
+		// can't heal them in the meantime.
+		unlock := lock(c, spec.Name)
+		g, ok, err := lookup(spec.Name)
+
+		if err == nil {
+			err = reconcile(c, spec, g, ok)
+		}
+
+		unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lookup returns a group, if it exists.
+func lookup(group string) (tesson.Group, bool, error) {
+	l, err := r.List()
+
+	if err != nil {
+		return tesson.Group{}, false, err
+	}
+
+	for _, g := range l {
+		if g.Name == group {
+			return g, true, nil
+		}
+	}
+
+	return tesson.Group{}, false, nil
+}
+
+// reconcile makes the changes required to bring a group in line with a
+// spec, if any. A group is updated if its config has changed or its image
+// tag has moved, and resized otherwise.
+func reconcile(c *cli.Context, spec tesson.Spec, g tesson.Group, exists bool) error {
+	opts, err := options(spec)
+
+	if err != nil {
+		return err
+	}
+
+	opts.Pull = c.String("pull")
+	opts.Auth = c.String("registry-auth")
+
+	l := opts.Layout
+
+	check, err := readiness(spec.Ready)
+
+	if err != nil {
+		return err
+	}
+
+	want, err := r.Revision(opts)
+
+	if err != nil {
+		return err
+	}
+
+	digest, err := resolve(g, opts)
+
+	if err != nil {
+		return err
+	}
+
+	if len(digest) != 0 {
+		opts.Pull = tesson.PullNever // Pulled already.
+	}
+
+	old := outdated(g, want, digest)
+
+	var f tesson.Frontend
+
+	if len(spec.Frontend.Gorb) != 0 {
+		f, err = tesson.NewGorbFrontend(spec.Frontend.Gorb, ns)
+	} else {
+		f, err = frontend(c)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var action string
+
+	switch {
+	case !exists:
+		action = "create"
+	case len(old) != 0:
+		action = "update"
+	default:
+		p := tesson.PlanLayout(g.Shards, l)
+
+		if len(p.Remove) == 0 && len(p.Create) == 0 {
+			log.Infof("group [%s] is up to date.", spec.Name)
+			return nil
+		}
+
+		action = "scale"
+	}
+
+	log.Infof("group [%s]: %s, %d shards, layout: %v.",
+		spec.Name, action, len(l), l)
+
+	if action == "update" {
+		log.Infof("group [%s]: %d stale shards, replaced one by one.",
+			spec.Name, len(old))
+	}
+
+	if c.Bool("dry-run") {
+		return nil
+	}
+
+	switch action {
+	case "update":
+		return update(
+			spec.Name, g, old, opts, f, check, c.Duration("ready-timeout"))
+	case "create":
+		i, err := r.Exec(spec.Name, opts)
+
+		if err != nil {
+			return err
+		}
+
+		return register(
+			spec.Name, i.Shards, f, check, c.Duration("ready-timeout"))
+	case "scale":
+		return resize(
+			spec.Name, l, f, check, c.Duration("ready-timeout"))
+	}
+
+	return nil
+}
+
+// update brings a group to a new config shard by shard, so that it keeps
+// serving throughout. Layout changes are made first, then stale shards are
+// replaced in place, each waiting for the previous one to become ready.
+// Shards which are up to date already, e.g. after an interrupted update,
+// are left intact.
+func update(group string, g tesson.Group, stale []tesson.Shard,
+	opts tesson.ExecOptions, f tesson.Frontend, check *tesson.ReadyCheck,
+	timeout time.Duration) error {
+
+	ids := make(map[string]struct{})
+
+	for _, s := range stale {
+		ids[s.ID] = struct{}{}
+	}
+
+	stop := tesson.StopOptions{
+		Purge:   true,
+		Timeout: 30 * time.Second}
+
+	p := tesson.PlanLayout(g.Shards, opts.Layout)
+	p.Options = &opts
+
+	if len(p.Remove) != 0 || len(p.Create) != 0 {
+		if f != nil {
+			if err := f.RemoveBackends(group, p.Remove); err != nil {
+				return err
+			}
+		}
+
+		s, err := r.Apply(group, p, stop)
+
+		if err != nil {
+			return err
+		}
+
+		if err := register(group, s, f, check, timeout); err != nil {
+			return err
+		}
+	}
+
+	for i, s := range p.Keep {
+		if _, ok := ids[s.ID]; !ok {
+			continue
+		}
+
+		log.Infof("group [%s]: replacing shard %d.", group, s.Ordinal)
+
+		if f != nil {
+			if err := f.RemoveBackends(group, []tesson.Shard{s}); err != nil {
+				return err
+			}
+		}
+
+		keep := append(append([]tesson.Shard{}, p.Keep[:i]...), p.Keep[i+1:]...)
+
+		l, err := r.Apply(group, tesson.Plan{
+			Keep:    keep,
+			Remove:  []tesson.Shard{s},
+			Create:  []tesson.Placement{{Ordinal: s.Ordinal, Unit: s.Unit}},
+			Options: &opts,
+		}, stop)
+
+		if err != nil {
+			return err
+		}
+
+		if err := register(group, l, f, check, timeout); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// options translates a spec into ExecOptions.
+func options(spec tesson.Spec) (tesson.ExecOptions, error) {
+	n := spec.Size
+
+	if n == 0 {
+		n = t.N()
+	}
+
+	unit := spec.Unit
+
+	if len(unit) == 0 {
+		unit = "core"
+	}
+
+	g, err := tesson.ParseGranularity(unit)
+
+	if err != nil {
+		return tesson.ExecOptions{}, err
+	}
+
+	l, err := t.Distribute(n, tesson.DistributeOptions{
+		Granularity: g,
+	})
+
+	if err != nil {
+		return tesson.ExecOptions{}, err
+	}
+
+	return tesson.ExecOptions{
+		Image:  spec.Image,
+		Layout: l,
+		Unit:   unit,
+		Ports:  spec.Ports,
+		Inline: spec.Config,
+		Names:  spec.Names,
+		Quotas: spec.Quotas}, nil
+}
+
+// specs reads group specs from a file.
+func specs(path string) ([]tesson.Spec, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	l, err := tesson.ParseSpecs(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := r.List()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range l {
+		if len(l[i].Name) == 0 {
+			l[i].Name = tesson.GroupName(l[i].Image, groups)
+		}
+	}
+
+	return l, nil
+}
+
+// outdated returns shards spawned from a different config, or from an image
+// other than the one the tag points to now, if known.
+func outdated(g tesson.Group, revision, digest string) []tesson.Shard {
+	var r []tesson.Shard
+
+	for _, s := range g.Shards {
+		if s.Revision != revision || len(digest) != 0 && s.Digest != digest {
+			r = append(r, s)
+		}
+	}
+
+	return r
+}
+
+// resolve returns the image reference a group would be spawned from now, if
+// the runtime pins groups to them. Missing groups don't need one.
+func resolve(g tesson.Group, opts tesson.ExecOptions) (string, error) {
+	res, ok := r.(tesson.Resolver)
+
+	if !ok || len(g.Digest) == 0 {
+		return "", nil
+	}
+
+	return res.Resolve(opts)
+}
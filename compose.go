@@ -0,0 +1,41 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+
+	"github.com/kobolog/tesson/lib"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var (
+	errComposeWithConfig = errors.New("--config and --from-compose are mutually exclusive")
+	errComposeWithSpec   = errors.New("--file and --from-compose are mutually exclusive")
+	errNoComposeService  = errors.New("--service is required with --from-compose")
+)
+
+// fromCompose reads the service given with --service from the compose file.
+func fromCompose(c *cli.Context) (tesson.Spec, error) {
+	if !c.IsSet("service") {
+		return tesson.Spec{}, errNoComposeService
+	}
+
+	return tesson.ParseCompose(c.String("from-compose"), c.String("service"))
+}
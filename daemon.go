@@ -0,0 +1,258 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kobolog/tesson/lib"
+	"gopkg.in/urfave/cli.v2"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	errNothingToFollow = errors.New("neither gorb nor healing is enabled")
+	errNoEventSupport  = errors.New("runtime doesn't support events")
+)
+
+// monitor keeps track of running shards and their frontend registrations.
+type monitor struct {
+	sync.Mutex
+
+	f      tesson.Frontend
+	dir    string        // State dir, where group locks are kept.
+	delay  time.Duration // Zero if healing is disabled.
+	groups map[string]map[string]tesson.Shard
+	timers map[string]*time.Timer
+}
+
+func daemon(c *cli.Context) error {
+	w, ok := r.(tesson.Watcher)
+
+	if !ok {
+		return errNoEventSupport
+	}
+
+	f, err := frontend(c)
+
+	if err != nil {
+		return err
+	}
+
+	if f == nil && !c.Bool("heal") {
+		return errNothingToFollow
+	}
+
+	m := &monitor{
+		f:      f,
+		dir:    c.String("state-dir"),
+		groups: make(map[string]map[string]tesson.Shard),
+		timers: make(map[string]*time.Timer)}
+
+	if c.Bool("heal") {
+		m.delay = c.Duration("heal-delay")
+	}
+
+	for {
+		// Events which happen while the state is being synchronized will
+		// be replayed once the stream is established.
+		since := time.Now()
+
+		if err := m.sync(); err != nil {
+			log.Errorf("unable to synchronize state: %v.", err)
+		} else {
+			err = w.Watch(since, func(e tesson.Event) error {
+				m.handle(e)
+				return nil
+			})
+
+			log.Warnf("event stream interrupted: %v.", err)
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// sync reconciles frontend registrations with the current runtime state.
+func (m *monitor) sync() error {
+	m.Lock()
+	defer m.Unlock()
+
+	l, err := r.List()
+
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]struct{})
+
+	for _, i := range l {
+		dead := false
+
+		for _, s := range i.Shards {
+			if s.State != "running" {
+				dead = dead || s.Dead()
+				continue
+			}
+
+			running[s.ID] = struct{}{}
+
+			if _, ok := m.groups[i.Name][s.ID]; !ok {
+				m.register(i.Name, s)
+			}
+		}
+
+		if dead {
+			m.schedule(i.Name)
+		}
+	}
+
+	for group, shards := range m.groups {
+		for id := range shards {
+			if _, ok := running[id]; !ok {
+				m.deregister(group, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m *monitor) handle(e tesson.Event) {
+	m.Lock()
+	defer m.Unlock()
+
+	log.Debugf("event: %s %.8s [%s].", e.Action, e.Shard, e.Group)
+
+	switch e.Action {
+	case "start":
+		i, err := r.Info(e.Group)
+
+		if err != nil {
+			log.Errorf("unable to inspect group [%s]: %v.", e.Group, err)
+			return
+		}
+
+		for _, s := range i.Shards {
+			if s.ID == e.Shard && s.State == "running" {
+				m.register(e.Group, s)
+			}
+		}
+	case "die", "destroy":
+		m.deregister(e.Group, e.Shard)
+		m.schedule(e.Group)
+	}
+}
+
+func (m *monitor) register(group string, s tesson.Shard) {
+	if m.f != nil {
+		// Stale registrations are dropped first, since the shard might've
+		// been restarted with different host ports.
+		if err := m.f.RemoveBackends(group, []tesson.Shard{s}); err != nil {
+			log.Errorf("unable to withdraw shard [%.8s]: %v.", s.ID, err)
+			return
+		}
+
+		if err := m.f.CreateService(group, []tesson.Shard{s}); err != nil {
+			log.Errorf("unable to register shard [%.8s]: %v.", s.ID, err)
+			return
+		}
+	}
+
+	if m.groups[group] == nil {
+		m.groups[group] = make(map[string]tesson.Shard)
+	}
+
+	m.groups[group][s.ID] = s
+}
+
+func (m *monitor) deregister(group, id string) {
+	s, ok := m.groups[group][id]
+
+	if !ok {
+		return
+	}
+
+	if m.f != nil {
+		if err := m.f.RemoveBackends(group, []tesson.Shard{s}); err != nil {
+			log.Errorf("unable to withdraw shard [%.8s]: %v.", s.ID, err)
+			return
+		}
+	}
+
+	delete(m.groups[group], id)
+
+	if len(m.groups[group]) == 0 {
+		delete(m.groups, group)
+	}
+}
+
+// schedule heals the group after a delay, unless healing is disabled or a
+// heal is pending already. Shards die one by one when the whole group is
+// stopped, so groups with no running shards left are not touched. Groups
+// which are being changed by other commands, e.g. stopped or scaled, are
+// healed once they're done.
+func (m *monitor) schedule(group string) {
+	if m.delay == 0 || m.timers[group] != nil {
+		return
+	}
+
+	m.timers[group] = time.AfterFunc(m.delay, func() { m.heal(group) })
+}
+
+// heal restores a group. The monitor isn't locked while the group is being
+// restored, so that events keep being handled in the meantime.
+func (m *monitor) heal(group string) {
+	m.Lock()
+
+	delete(m.timers, group)
+	n := len(m.groups[group])
+
+	m.Unlock()
+
+	if n == 0 {
+		log.Infof("group [%s] has no running shards, not healing.", group)
+		return
+	}
+
+	l, err := ns.LockGroup(m.dir, group, false)
+
+	switch {
+	case err == tesson.ErrGroupLocked:
+		log.Infof("group [%s] is being changed, healing later.", group)
+
+		m.Lock()
+		m.schedule(group)
+		m.Unlock()
+
+		return
+	case err != nil:
+		log.Warnf("unable to lock group [%s]: %v.", group, err)
+	default:
+		defer l.Unlock()
+	}
+
+	// Replacements are registered once their start events arrive.
+	if err := restore(group, 0, "", nil); err != nil {
+		log.Errorf("unable to heal group [%s]: %v.", group, err)
+	}
+}
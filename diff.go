@@ -0,0 +1,133 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/kobolog/tesson/lib"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var (
+	errNoDiffSupport = errors.New("runtime doesn't support drift detection")
+	errDriftDetected = errors.New("drift detected")
+)
+
+func diff(c *cli.Context) error {
+	d, ok := r.(tesson.Differ)
+
+	if !ok {
+		return errNoDiffSupport
+	}
+
+	type target struct {
+		group string
+		opts  *tesson.ExecOptions
+	}
+
+	var (
+		targets []target
+		l       []tesson.Spec
+		err     error
+	)
+
+	switch {
+	case c.IsSet("file") && c.IsSet("from-compose"):
+		return errComposeWithSpec
+	case c.IsSet("file"):
+		l, err = specs(c.String("file"))
+	case c.IsSet("from-compose"):
+		var spec tesson.Spec
+
+		spec, err = fromCompose(c)
+		l = append(l, spec)
+	case c.IsSet("group"):
+		targets = append(targets, target{group: c.String("group")})
+	default:
+		return cli.ShowCommandHelp(c, "diff")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range l {
+		if c.IsSet("group") && spec.Name != c.String("group") {
+			continue
+		}
+
+		opts, err := options(spec)
+
+		if err != nil {
+			return err
+		}
+
+		targets = append(targets, target{group: spec.Name, opts: &opts})
+	}
+
+	groups, err := r.List()
+
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]struct{})
+
+	for _, g := range groups {
+		running[g.Name] = struct{}{}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	n := 0
+
+	fmt.Fprintf(w, "GROUP\tORDINAL\tINSTANCE ID\tDRIFT\tWANT\tHAVE\n")
+
+	for _, i := range targets {
+		if _, ok := running[i.group]; !ok {
+			fmt.Fprintf(w, "%s\t*\t\tmissing\t\t\n", i.group)
+			n++
+			continue
+		}
+
+		l, err := d.Diff(i.group, tesson.DiffOptions{Target: i.opts})
+
+		if err != nil {
+			return err
+		}
+
+		for _, drift := range l {
+			fmt.Fprintf(w, "%s\t%d\t%.8s\t%s\t%s\t%s\n", i.group,
+				drift.Ordinal, drift.ID, drift.Kind, drift.Want, drift.Have)
+		}
+
+		n += len(l)
+	}
+
+	w.Flush()
+
+	if n != 0 {
+		return errDriftDetected
+	}
+
+	return nil
+}
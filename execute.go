@@ -0,0 +1,120 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/kobolog/tesson/lib"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var (
+	errNoExecSupport = errors.New("runtime doesn't support running commands")
+)
+
+func execute(c *cli.Context) error {
+	if !c.IsSet("group") || c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, "exec")
+	}
+
+	e, ok := r.(tesson.Executor)
+
+	if !ok {
+		return errNoExecSupport
+	}
+
+	group := c.String("group")
+
+	i, err := r.Info(group)
+
+	if err != nil {
+		return err
+	}
+
+	var (
+		cmd     = c.Args().Slice()
+		results = make([]tesson.Result, len(i.Shards))
+		errs    = make([]error, len(i.Shards))
+		wg      sync.WaitGroup
+	)
+
+	for n, s := range i.Shards {
+		if !c.Bool("parallel") {
+			results[n], errs[n] = e.Execute(s, cmd)
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(n int, s tesson.Shard) {
+			defer wg.Done()
+			results[n], errs[n] = e.Execute(s, cmd)
+		}(n, s)
+	}
+
+	wg.Wait()
+
+	failed := 0
+
+	for n, s := range i.Shards {
+		fmt.Printf("==> shard %s [%s] <==\n", ordinal(s), s.Unit)
+
+		if errs[n] != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", errs[n])
+		} else {
+			os.Stdout.Write(results[n].Stdout)
+			os.Stderr.Write(results[n].Stderr)
+		}
+
+		if errs[n] != nil || results[n].ExitCode != 0 {
+			failed++
+		}
+	}
+
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+
+	fmt.Fprintf(w, "INSTANCE ID\tORDINAL\tEXIT CODE\tERROR\n")
+
+	for n, s := range i.Shards {
+		code, reason := fmt.Sprint(results[n].ExitCode), ""
+
+		if errs[n] != nil {
+			code, reason = "-", errs[n].Error()
+		}
+
+		fmt.Fprintf(w, "%.8s\t%s\t%s\t%s\n", s.ID, ordinal(s), code, reason)
+	}
+
+	w.Flush()
+
+	if failed != 0 {
+		return fmt.Errorf("'%s' failed on %d of %d shards",
+			strings.Join(cmd, " "), failed, len(i.Shards))
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/kobolog/tesson/lib"
+	"gopkg.in/urfave/cli.v2"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	errNoComposeSupport = errors.New("runtime doesn't support compose export")
+)
+
+func exportSystemd(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.ShowCommandHelp(c, "systemd")
+	}
+
+	var n int
+
+	if c.Int("size") > 0 {
+		n = c.Int("size")
+	} else {
+		n = t.N()
+	}
+
+	g, err := tesson.ParseGranularity(c.String("unit"))
+
+	if err != nil {
+		return err
+	}
+
+	l, err := t.Distribute(n, tesson.DistributeOptions{
+		Granularity: g,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	opts := tesson.ExecOptions{
+		Image:  c.Args().Get(0),
+		Args:   c.Args().Tail(),
+		Layout: l,
+		Quotas: quotas(c),
+		Env:    c.StringSlice("env")}
+
+	var group string
+
+	if c.IsSet("group") {
+		group = c.String("group")
+	} else {
+		group = tesson.GroupName(filepath.Base(opts.Image), nil)
+	}
+
+	files, err := tesson.ExportSystemd(group, opts, ns)
+
+	if err != nil {
+		return err
+	}
+
+	return write(c.String("output"), files)
+}
+
+// write saves generated files into dir.
+func write(dir string, files []tesson.File) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		path := filepath.Join(dir, f.Name)
+
+		if err := ioutil.WriteFile(path, f.Content, 0644); err != nil {
+			return err
+		}
+
+		log.Infof("file written: %s.", path)
+	}
+
+	return nil
+}
+
+func exportCompose(c *cli.Context) error {
+	if c.NArg() == 0 && !c.IsSet("group") {
+		return cli.ShowCommandHelp(c, "compose")
+	}
+
+	cp, ok := r.(tesson.Composer)
+
+	if !ok {
+		return errNoComposeSupport
+	}
+
+	var (
+		b   []byte
+		err error
+	)
+
+	if c.NArg() == 0 {
+		// No image given, so the running group is exported.
+		b, err = cp.Recompose(c.String("group"))
+	} else {
+		b, err = compose(c, cp)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !c.IsSet("output") {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+
+	return ioutil.WriteFile(c.String("output"), b, 0644)
+}
+
+// compose describes a planned group, as it would be spawned by run.
+func compose(c *cli.Context, cp tesson.Composer) ([]byte, error) {
+	var n int
+
+	if c.Int("size") > 0 {
+		n = c.Int("size")
+	} else {
+		n = t.N()
+	}
+
+	g, err := tesson.ParseGranularity(c.String("unit"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := t.Distribute(n, tesson.DistributeOptions{
+		Granularity: g,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	opts := tesson.ExecOptions{
+		Image:      c.Args().Get(0),
+		Args:       c.Args().Tail(),
+		Layout:     l,
+		Ports:      c.StringSlice("port"),
+		Config:     c.String("config"),
+		Names:      c.String("names"),
+		Quotas:     quotas(c),
+		Env:        c.StringSlice("env"),
+		Volumes:    c.StringSlice("volume"),
+		Entrypoint: c.String("entrypoint"),
+		Network:    c.String("network"),
+		Labels:     c.StringSlice("label")}
+
+	var group string
+
+	if c.IsSet("group") {
+		group = c.String("group")
+	} else if group, err = groupName(opts.Image); err != nil {
+		return nil, err
+	}
+
+	return cp.Compose(group, opts)
+}
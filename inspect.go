@@ -0,0 +1,155 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kobolog/tesson/lib"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var (
+	errNoInspectSupport = errors.New("runtime doesn't support inspection")
+)
+
+func inspect(c *cli.Context) error {
+	if !c.IsSet("group") {
+		return cli.ShowCommandHelp(c, "inspect")
+	}
+
+	in, ok := r.(tesson.Inspector)
+
+	if !ok {
+		return errNoInspectSupport
+	}
+
+	g, err := in.Inspect(c.String("group"))
+
+	if err != nil {
+		return err
+	}
+
+	f, err := frontend(c)
+
+	if err != nil {
+		return err
+	}
+
+	if reg, ok := f.(tesson.Registry); ok {
+		m, err := reg.Backends(g.Name, g.Shards)
+
+		if err != nil {
+			return err
+		}
+
+		for i := range g.Shards {
+			g.Shards[i].Backends = m[g.Shards[i].ID]
+		}
+	}
+
+	if c.Bool("json") {
+		return json.NewEncoder(os.Stdout).Encode(g)
+	}
+
+	describe(g, f != nil)
+
+	return nil
+}
+
+// describe prints a readable group description.
+func describe(g tesson.Group, registrations bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+
+	fmt.Fprintf(w, "Group:\t%s\n", g.Name)
+	fmt.Fprintf(w, "Image:\t%s\n", g.Image)
+	fmt.Fprintf(w, "Digest:\t%s\n", g.Digest)
+	fmt.Fprintf(w, "Shards:\t%d\n", len(g.Shards))
+
+	for _, s := range g.Shards {
+		state := s.State
+
+		if len(s.Health) != 0 {
+			state = fmt.Sprintf("%s (%s)", state, s.Health)
+		}
+
+		fmt.Fprintf(w, "\nShard %s:\n", ordinal(s))
+		fmt.Fprintf(w, "  ID:\t%s\n", s.ID)
+		fmt.Fprintf(w, "  Name:\t%s\n", s.Name)
+		fmt.Fprintf(w, "  Created:\t%s\n", s.Created.Local())
+		fmt.Fprintf(w, "  State:\t%s, exit code %d, %d restarts\n",
+			state, s.ExitCode, s.Restarts)
+		fmt.Fprintf(w, "  Layout:\tcpus %s, mems %s, node %s, socket %s\n",
+			s.Unit, orNone(s.Mems), index(s.Unit.Node()),
+			index(s.Unit.Socket()))
+		fmt.Fprintf(w, "  Ports:\t%s\n", orNone(ports(s)))
+
+		if len(s.IP) != 0 {
+			fmt.Fprintf(w, "  Address:\t%s\n", s.IP)
+		}
+
+		if registrations {
+			fmt.Fprintf(w, "  Frontend:\t%s\n",
+				orNone(strings.Join(s.Backends, ", ")))
+		}
+
+		fmt.Fprintf(w, "  Revision:\t%.12s\n", s.Revision)
+		fmt.Fprintf(w, "  Config hash:\t%.12s\n", s.Hash)
+	}
+
+	w.Flush()
+}
+
+// ports formats published ports the way Docker does.
+func ports(s tesson.Shard) string {
+	var l []string
+
+	for _, p := range s.Ports {
+		if p.PublicPort == 0 {
+			l = append(l, fmt.Sprintf("%d/%s", p.PrivatePort, p.Type))
+			continue
+		}
+
+		l = append(l, fmt.Sprintf("%s:%d->%d/%s",
+			p.IP, p.PublicPort, p.PrivatePort, p.Type))
+	}
+
+	return strings.Join(l, ", ")
+}
+
+func index(n int) string {
+	if n < 0 {
+		return "several"
+	}
+
+	return fmt.Sprint(n)
+}
+
+func orNone(s string) string {
+	if len(s) == 0 {
+		return "none"
+	}
+
+	return s
+}
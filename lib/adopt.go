@@ -0,0 +1,332 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docker/engine-api/types"
+	"github.com/docker/engine-api/types/container"
+	"github.com/docker/engine-api/types/network"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Adopter is implemented by runtimes which can take over shards started by
+// hand. Their cpusets are mapped back to units with the Locator. Containers
+// are adopted one by one; if one fails, it's restored, and the shards which
+// were adopted before it are returned along with the error.
+type Adopter interface {
+	Adopt(group string, ids []string, l Locator, opts StopOptions) ([]Shard, error)
+}
+
+// Implementation
+
+func (d *docker) Adopt(
+	group string, ids []string, loc Locator, opts StopOptions) ([]Shard, error) {
+
+	l, err := d.List()
+
+	if err != nil {
+		return nil, err
+	}
+
+	next := 0
+
+	for _, g := range l {
+		if g.Name != group {
+			continue
+		}
+
+		for _, s := range g.Shards {
+			if s.Ordinal >= next {
+				next = s.Ordinal + 1
+			}
+		}
+	}
+
+	if err := CheckGroup(group, l); err != nil {
+		return nil, err
+	}
+
+	var (
+		pending []types.ContainerJSON
+		units   []Unit
+		live    []Unit // Units of running containers, see admit.
+		adopted = make(map[string]struct{})
+	)
+
+	for _, id := range ids {
+		j, err := d.client.ContainerInspect(d.ctx, id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if name, ok := j.Config.Labels["tesson.group"]; ok {
+			if name != group || !d.ns.owns(j.Config.Labels) {
+				return nil, fmt.Errorf(
+					"container %.12s belongs to group [%s]", j.ID, name)
+			}
+
+			adopted[j.ID] = struct{}{} // Adopted already.
+			continue
+		}
+
+		if len(j.HostConfig.CpusetCpus) == 0 {
+			return nil, fmt.Errorf("container %.12s is not pinned", j.ID)
+		}
+
+		u, err := loc.Locate(j.HostConfig.CpusetCpus)
+
+		if err != nil {
+			return nil, fmt.Errorf("container %.12s: %v", j.ID, err)
+		}
+
+		pending, units = append(pending, j), append(units, u)
+
+		if j.State.Running {
+			live = append(live, u)
+		}
+	}
+
+	if err := d.ns.admit(l, cpus(live)); err != nil {
+		return nil, err
+	}
+
+	var failed error
+
+	for i, j := range pending {
+		id, err := d.adopt(group, j, Placement{Ordinal: next + i, Unit: units[i]}, opts)
+
+		if err != nil {
+			failed = fmt.Errorf("container %.12s: %v", j.ID, err)
+			break
+		}
+
+		adopted[id] = struct{}{}
+	}
+
+	var r []Shard
+
+	// The group might not exist if nothing has been adopted.
+	if g, err := d.Info(group); err == nil {
+		for _, shard := range g.Shards {
+			if _, ok := adopted[shard.ID]; ok {
+				r = append(r, shard)
+			}
+		}
+	} else if failed == nil {
+		return nil, err
+	}
+
+	return r, failed
+}
+
+// adopt replaces a container with one which has the same config and carries
+// tesson labels, since labels can't be changed in place. The container config
+// becomes the group config, which further shards are spawned from.
+func (d *docker) adopt(group string,
+	j types.ContainerJSON, p Placement, opts StopOptions) (string, error) {
+
+	cfg := config{Config: *j.Config, HostConfig: *j.HostConfig}
+
+	if cfg.Hostname == j.ID[:12] {
+		cfg.Hostname = "" // Assigned by Docker.
+	}
+
+	cfg.HostConfig.Resources.CpusetCpus = ""
+	cfg.Env = groupEnv(cfg.Env)
+	cfg.digest = j.Image // Keeps the exact image, even if the tag has moved.
+
+	b, err := json.Marshal(cfg)
+
+	if err != nil {
+		return "", err
+	}
+
+	var c config
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return "", err
+	}
+
+	c.HostConfig.Resources.CpusetCpus = p.Unit.String()
+
+	if err := d.label(&c, group, cfg, b, p); err != nil {
+		return "", err
+	}
+
+	c.Image = cfg.digest
+	c.Env = append(c.Env, shardEnv(p)...)
+	c.names = strings.TrimPrefix(j.Name, "/")
+	c.HostConfig.Binds = append(c.HostConfig.Binds, volumes(j)...)
+
+	extra := endpoints(j)
+
+	if mode := c.HostConfig.NetworkMode; mode.IsUserDefined() {
+		if e, ok := extra[mode.NetworkName()]; ok {
+			c.NetworkingConfig = &network.NetworkingConfig{
+				EndpointsConfig: map[string]*network.EndpointSettings{
+					mode.NetworkName(): e}}
+
+			delete(extra, mode.NetworkName())
+		}
+	}
+
+	// Renamed to free the name for the replacement.
+	orig := sanitize(fmt.Sprintf("%s-%.12s", c.names, j.ID))
+
+	if err := d.client.ContainerRename(d.ctx, j.ID, orig); err != nil {
+		return "", err
+	}
+
+	if err := d.stop(group, j.ID, StopOptions{Timeout: opts.Timeout}); err != nil {
+		d.restore(j, c.names, "")
+		return "", err
+	}
+
+	var id string
+
+	// Stopped containers stay stopped, so they're only created.
+	if j.State.Running {
+		id, err = d.spawn(group, c)
+	} else {
+		id, err = d.create(group, c)
+	}
+
+	if err != nil {
+		d.restore(j, c.names, "")
+		return "", err
+	}
+
+	for name, e := range extra {
+		if err := d.client.NetworkConnect(d.ctx, name, id, e); err != nil {
+			d.restore(j, c.names, id)
+			return "", err
+		}
+	}
+
+	log.Infof("container adopted: %.12s -> %.12s.", j.ID, id)
+
+	if !opts.Purge {
+		return id, nil
+	}
+
+	// Volumes are in use by the replacement. The replacement is up already,
+	// so the original is only left behind if it can't be removed.
+	if err := d.client.ContainerRemove(
+		d.ctx, j.ID, types.ContainerRemoveOptions{},
+	); err != nil {
+		log.Warnf("unable to remove container %.12s: %v.", j.ID, err)
+	}
+
+	return id, nil
+}
+
+// restore brings back a container which failed to be replaced, removing the
+// replacement first, if any.
+func (d *docker) restore(j types.ContainerJSON, name, replacement string) {
+	if len(replacement) != 0 {
+		if err := d.client.ContainerRemove(
+			d.ctx, replacement, types.ContainerRemoveOptions{Force: true},
+		); err != nil {
+			log.Errorf("unable to remove container %.12s: %v.", replacement, err)
+			return
+		}
+	}
+
+	if err := d.client.ContainerRename(d.ctx, j.ID, name); err != nil {
+		log.Errorf("unable to restore container %.12s: %v.", j.ID, err)
+		return
+	}
+
+	if !j.State.Running {
+		return
+	}
+
+	if err := d.client.ContainerStart(
+		d.ctx, j.ID, types.ContainerStartOptions{},
+	); err != nil {
+		log.Errorf("unable to restart container %.12s: %v.", j.ID, err)
+	}
+}
+
+// volumes returns bindings for volumes mounted without one, e.g. anonymous
+// volumes declared by the image, so that the replacement keeps its data.
+func volumes(j types.ContainerJSON) []string {
+	bound := make(map[string]struct{})
+
+	for _, b := range j.HostConfig.Binds {
+		if p := strings.Split(b, ":"); len(p) > 1 {
+			bound[p[1]] = struct{}{}
+		}
+	}
+
+	var r []string
+
+	for _, m := range j.Mounts {
+		if _, ok := bound[m.Destination]; ok || len(m.Name) == 0 {
+			continue
+		}
+
+		b := fmt.Sprintf("%s:%s", m.Name, m.Destination)
+
+		if !m.RW {
+			b += ":ro"
+		}
+
+		r = append(r, b)
+	}
+
+	return r
+}
+
+// endpoints returns the settings of user-defined networks a container is
+// connected to, leaving out the ones Docker assigns.
+func endpoints(j types.ContainerJSON) map[string]*network.EndpointSettings {
+	r := make(map[string]*network.EndpointSettings)
+
+	if j.NetworkSettings == nil {
+		return r
+	}
+
+	for name, e := range j.NetworkSettings.Networks {
+		if !container.NetworkMode(name).IsUserDefined() || e == nil {
+			continue
+		}
+
+		var aliases []string
+
+		for _, a := range e.Aliases {
+			if a != j.ID[:12] {
+				aliases = append(aliases, a)
+			}
+		}
+
+		r[name] = &network.EndpointSettings{
+			IPAMConfig: e.IPAMConfig,
+			Links:      e.Links,
+			Aliases:    aliases}
+	}
+
+	return r
+}
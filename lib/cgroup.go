@@ -0,0 +1,230 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/docker/engine-api/types/container"
+)
+
+const (
+	cgroupRoot  = "/sys/fs/cgroup"
+	cgroupSlice = "tesson.slice"
+)
+
+var (
+	errNoUnifiedHierarchy = errors.New("cgroup v2 is not available")
+)
+
+// Implementation
+
+// cgroup creates a shard cgroup under the Tesson slice (or the configured
+// cgroup parent) and applies the resource limits there, so that the shard
+// process is confined from the very start. Returns the cgroup path, which is
+// empty if cgroups are not available and there are no limits to enforce.
+func (p *process) cgroup(group string, ordinal int, r container.Resources) (string, error) {
+	l := limits(r)
+
+	if _, err := os.Stat(filepath.Join(p.cgroups, "cgroup.controllers")); err != nil {
+		if len(l) != 0 {
+			return "", errNoUnifiedHierarchy
+		}
+
+		return "", nil
+	}
+
+	slice := filepath.Join(p.cgroups, cgroupSlice)
+
+	if len(r.CgroupParent) != 0 {
+		slice = filepath.Join(p.cgroups, r.CgroupParent)
+	}
+
+	if err := p.enable(slice, controllers(l)); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(slice,
+		fmt.Sprintf("%s-%d", sanitize(p.ns.qualify(group)), ordinal))
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return "", err
+	}
+
+	for file, value := range l {
+		if err := write(filepath.Join(path, file), value); err != nil {
+			os.Remove(path)
+			return "", fmt.Errorf("%s: %v", file, err)
+		}
+	}
+
+	return path, nil
+}
+
+// enable creates the slice and enables controllers along the whole path from
+// the root, since a controller is only available in a cgroup if it's enabled
+// in all of its parents.
+func (p *process) enable(slice string, l []string) error {
+	rel, err := filepath.Rel(p.cgroups, slice)
+
+	if err != nil {
+		return err
+	}
+
+	dir := p.cgroups
+
+	for _, name := range append([]string{""}, strings.Split(rel, string(filepath.Separator))...) {
+		dir = filepath.Join(dir, name)
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		for _, c := range l {
+			if err := write(filepath.Join(dir, "cgroup.subtree_control"), "+"+c); err != nil {
+				return fmt.Errorf("unable to enable %s controller in %s: %v", c, dir, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// controllers returns the controllers which limits require, e.g. memory for
+// memory.max.
+func controllers(limits map[string]string) []string {
+	var l []string
+
+	seen := make(map[string]bool)
+
+	for file := range limits {
+		c := strings.SplitN(file, ".", 2)[0]
+
+		if !seen[c] {
+			seen[c], l = true, append(l, c)
+		}
+	}
+
+	sort.Strings(l)
+
+	return l
+}
+
+// kill sends a signal to every process in a cgroup, so that children which
+// the shard process has forked don't outlive it. Processes which have exited
+// in the meantime are skipped.
+func kill(cgroup string, sig syscall.Signal) error {
+	if sig == syscall.SIGKILL {
+		// Kills atomically, even processes forking at the same time, but it's
+		// only available since Linux 5.14.
+		if err := write(filepath.Join(cgroup, "cgroup.kill"), "1"); err == nil {
+			return nil
+		}
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(cgroup, "cgroup.procs"))
+
+	if err != nil {
+		return err
+	}
+
+	for _, field := range strings.Fields(string(b)) {
+		pid, err := strconv.Atoi(field)
+
+		if err != nil {
+			return fmt.Errorf("cgroup.procs: %v", err)
+		}
+
+		if err := syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// enter moves a process, stopped at exec by ptrace, into a cgroup and lets
+// it run. Must be called from the thread which started the process, since
+// it's the tracer.
+func enter(pid int, cgroup string) error {
+	var ws syscall.WaitStatus
+
+	if _, err := syscall.Wait4(pid, &ws, 0, nil); err != nil {
+		return err
+	}
+
+	if !ws.Stopped() {
+		return fmt.Errorf("process exited before entering its cgroup")
+	}
+
+	if err := write(filepath.Join(cgroup, "cgroup.procs"), strconv.Itoa(pid)); err != nil {
+		return err
+	}
+
+	return syscall.PtraceDetach(pid)
+}
+
+// limits translates container resources into cgroup v2 interface files.
+func limits(r container.Resources) map[string]string {
+	l := make(map[string]string)
+
+	if r.Memory != 0 {
+		l["memory.max"] = strconv.FormatInt(r.Memory, 10)
+	}
+
+	if r.MemoryReservation != 0 {
+		l["memory.low"] = strconv.FormatInt(r.MemoryReservation, 10)
+	}
+
+	if r.CPUShares != 0 {
+		l["cpu.weight"] = strconv.FormatInt(weight(r.CPUShares), 10)
+	}
+
+	if r.CPUQuota != 0 {
+		l["cpu.max"] = fmt.Sprintf("%d %d", r.CPUQuota, r.CPUPeriod)
+	}
+
+	if r.PidsLimit != 0 {
+		l["pids.max"] = strconv.FormatInt(r.PidsLimit, 10)
+	}
+
+	if r.BlkioWeight != 0 {
+		l["io.weight"] = fmt.Sprintf("default %d", r.BlkioWeight)
+	}
+
+	return l
+}
+
+// weight converts cpu shares [2, 262144] to cpu weight [1, 10000], same as
+// runc does.
+func weight(shares int64) int64 {
+	return 1 + (shares-2)*9999/262142
+}
+
+func write(path, value string) error {
+	return ioutil.WriteFile(path, []byte(value), 0644)
+}
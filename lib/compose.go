@@ -0,0 +1,836 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/engine-api/types/container"
+	"github.com/docker/engine-api/types/network"
+	"github.com/docker/engine-api/types/strslice"
+	"github.com/docker/go-connections/nat"
+	"gopkg.in/yaml.v2"
+)
+
+// Composer is implemented by runtimes which can describe groups as compose
+// files, with one service per shard.
+type Composer interface {
+	// Compose describes a group as it would be spawned with opts.
+	Compose(group string, opts ExecOptions) ([]byte, error)
+
+	// Recompose describes a running group.
+	Recompose(group string) ([]byte, error)
+}
+
+// Compose file format 2.4 is the latest to support all resource options
+// without swarm mode, and is understood by docker compose as well.
+const composeVersion = "2.4"
+
+type composeFile struct {
+	Version  string                     `yaml:"version"`
+	Services map[string]composeService  `yaml:"services"`
+	Networks map[string]composeExternal `yaml:"networks,omitempty"`
+}
+
+type composeService struct {
+	Image          string                     `yaml:"image"`
+	ContainerName  string                     `yaml:"container_name,omitempty"`
+	Hostname       string                     `yaml:"hostname,omitempty"`
+	User           string                     `yaml:"user,omitempty"`
+	WorkingDir     string                     `yaml:"working_dir,omitempty"`
+	Entrypoint     []string                   `yaml:"entrypoint,omitempty"`
+	Command        []string                   `yaml:"command,omitempty"`
+	Environment    []string                   `yaml:"environment,omitempty"`
+	Ports          []string                   `yaml:"ports,omitempty"`
+	Expose         []string                   `yaml:"expose,omitempty"`
+	Volumes        []string                   `yaml:"volumes,omitempty"`
+	NetworkMode    string                     `yaml:"network_mode,omitempty"`
+	Networks       map[string]composeEndpoint `yaml:"networks,omitempty"`
+	Labels         map[string]string          `yaml:"labels,omitempty"`
+	Cpuset         string                     `yaml:"cpuset,omitempty"`
+	CPUShares      int64                      `yaml:"cpu_shares,omitempty"`
+	CPUQuota       int64                      `yaml:"cpu_quota,omitempty"`
+	CPUPeriod      int64                      `yaml:"cpu_period,omitempty"`
+	MemLimit       int64                      `yaml:"mem_limit,omitempty"`
+	MemReservation int64                      `yaml:"mem_reservation,omitempty"`
+	PidsLimit      int64                      `yaml:"pids_limit,omitempty"`
+	BlkioConfig    *composeBlkio              `yaml:"blkio_config,omitempty"`
+	CgroupParent   string                     `yaml:"cgroup_parent,omitempty"`
+	Restart        string                     `yaml:"restart,omitempty"`
+}
+
+type composeEndpoint struct {
+	Aliases     []string `yaml:"aliases,omitempty"`
+	IPv4Address string   `yaml:"ipv4_address,omitempty"`
+}
+
+type composeExternal struct {
+	External bool `yaml:"external"`
+}
+
+type composeBlkio struct {
+	Weight uint16 `yaml:"weight"`
+}
+
+var (
+	errSeveralNetworks = errors.New("shards can only be connected to one network")
+)
+
+// composeInput is the subset of a compose file which is imported. Unlike the
+// output, it has to accept all the alternative syntaxes.
+type composeInput struct {
+	Name     string                     `yaml:"name"`
+	Services map[string]composeSource   `yaml:"services"`
+	Volumes  map[string]composeResource `yaml:"volumes"`
+	Networks map[string]composeResource `yaml:"networks"`
+}
+
+// composeResource is a top-level volume or network.
+type composeResource struct {
+	Name     string      `yaml:"name"`
+	External interface{} `yaml:"external"` // Either a flag or {name: ...}.
+}
+
+// composeProject is what services are resolved against: volumes and networks
+// are named after the project, and relative paths are relative to the
+// directory of the compose file.
+type composeProject struct {
+	name     string
+	dir      string
+	volumes  map[string]composeResource
+	networks map[string]composeResource
+}
+
+type composeSource struct {
+	Image       string        `yaml:"image"`
+	Hostname    string        `yaml:"hostname"`
+	User        string        `yaml:"user"`
+	WorkingDir  string        `yaml:"working_dir"`
+	Entrypoint  composeList   `yaml:"entrypoint"`
+	Command     composeList   `yaml:"command"`
+	Environment composeList   `yaml:"environment"`
+	Labels      composeList   `yaml:"labels"`
+	Ports       []interface{} `yaml:"ports"`
+	Expose      []interface{} `yaml:"expose"`
+	Volumes     []interface{} `yaml:"volumes"`
+	Networks    interface{}   `yaml:"networks"`
+	NetworkMode string        `yaml:"network_mode"`
+	Restart     string        `yaml:"restart"`
+	CapAdd      []string      `yaml:"cap_add"`
+	CapDrop     []string      `yaml:"cap_drop"`
+	ExtraHosts  []string      `yaml:"extra_hosts"`
+	Privileged  bool          `yaml:"privileged"`
+	Healthcheck *struct {
+		Test     interface{} `yaml:"test"`
+		Interval string      `yaml:"interval"`
+		Timeout  string      `yaml:"timeout"`
+		Retries  int         `yaml:"retries"`
+		Disable  bool        `yaml:"disable"`
+	} `yaml:"healthcheck"`
+}
+
+// composeList is either a list, a mapping turned into "key=value" items, or
+// a string, which is split into words the way a shell would.
+type composeList []string
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (l *composeList) UnmarshalYAML(fn func(interface{}) error) error {
+	var v interface{}
+
+	if err := fn(&v); err != nil {
+		return err
+	}
+
+	switch v := v.(type) {
+	case string:
+		words, err := shellwords(v)
+
+		if err != nil {
+			return err
+		}
+
+		*l = words
+	case []interface{}:
+		for _, item := range v {
+			*l = append(*l, fmt.Sprint(item))
+		}
+	case map[interface{}]interface{}:
+		for k, item := range v {
+			if item == nil {
+				*l = append(*l, fmt.Sprint(k))
+			} else {
+				*l = append(*l, fmt.Sprintf("%v=%v", k, item))
+			}
+		}
+
+		sort.Strings(*l)
+	}
+
+	return nil
+}
+
+// shellwords splits a command line into words, honoring quotes and escapes
+// as a POSIX shell does, but without any expansions.
+func shellwords(s string) ([]string, error) {
+	var (
+		words []string
+		word  []rune
+		quote rune
+		found bool // Whether a word has started, even if it's empty.
+		slash bool
+	)
+
+	for _, c := range s {
+		switch {
+		case slash:
+			// Inside double quotes, backslash only escapes a few characters.
+			if quote == '"' && !strings.ContainsRune("\\\"$`\n", c) {
+				word = append(word, '\\')
+			}
+
+			if c != '\n' {
+				word = append(word, c)
+			}
+
+			slash = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word = append(word, c)
+			}
+		case c == '\\':
+			slash, found = true, true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				word = append(word, c)
+			}
+		case c == '\'' || c == '"':
+			quote, found = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if found {
+				words = append(words, string(word))
+			}
+
+			word, found = word[:0], false
+		default:
+			word, found = append(word, c), true
+		}
+	}
+
+	if quote != 0 || slash {
+		return nil, fmt.Errorf("unterminated quote or escape: %s", s)
+	}
+
+	if found {
+		words = append(words, string(word))
+	}
+
+	return words, nil
+}
+
+// ParseCompose reads a service from a compose file, and translates it into
+// a group spec with the equivalent container config. Relative paths in the
+// service are resolved against the directory of the file, same as compose
+// does.
+func ParseCompose(path, service string) (Spec, error) {
+	b, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return Spec{}, err
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+
+	if err != nil {
+		return Spec{}, err
+	}
+
+	return parseCompose(b, dir, service)
+}
+
+// Implementation
+
+func parseCompose(b []byte, dir, service string) (Spec, error) {
+	var f composeInput
+
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return Spec{}, err
+	}
+
+	src, ok := f.Services[service]
+
+	if !ok {
+		return Spec{}, fmt.Errorf("service [%s] is not defined", service)
+	}
+
+	var err error
+
+	spec := Spec{Name: service, Image: src.Image}
+
+	for _, p := range src.Ports {
+		if spec.Ports, err = appendPort(spec.Ports, p); err != nil {
+			return Spec{}, err
+		}
+	}
+
+	cfg, err := src.config(composeProject{
+		name:     projectName(f.Name, dir),
+		dir:      dir,
+		volumes:  f.Volumes,
+		networks: f.Networks})
+
+	if err != nil {
+		return Spec{}, err
+	}
+
+	if spec.Config, err = json.Marshal(cfg); err != nil {
+		return Spec{}, err
+	}
+
+	return spec, nil
+}
+
+func (d *docker) Compose(group string, opts ExecOptions) ([]byte, error) {
+	if opts.Macvlan != nil && len(opts.Network) == 0 {
+		opts.Network = sanitize(d.ns.qualify(group))
+	}
+
+	cfg, err := d.configure(opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.names = opts.Names; len(cfg.names) == 0 {
+		cfg.names = DefaultNames
+	}
+
+	if cfg.names == DefaultNames {
+		cfg.names = d.ns.qualify(cfg.names)
+	}
+
+	if err := opts.Quotas.validate(); err != nil {
+		return nil, err
+	}
+
+	cfg.quotas, cfg.layout = opts.Quotas, opts.Layout
+
+	var l []Placement
+
+	for i, u := range opts.Layout {
+		l = append(l, Placement{Ordinal: i, Unit: u})
+	}
+
+	return d.compose(group, cfg, l)
+}
+
+func (d *docker) Recompose(group string) ([]byte, error) {
+	i, err := d.Info(group)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := d.template(group)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var l []Placement
+
+	for _, shard := range i.Shards {
+		l = append(l, Placement{Ordinal: shard.Ordinal, Unit: shard.Unit})
+		cfg.layout = append(cfg.layout, shard.Unit)
+	}
+
+	return d.compose(group, cfg, l)
+}
+
+// compose builds a compose file with a service for each placement.
+func (d *docker) compose(group string, cfg config, l []Placement) ([]byte, error) {
+	f := composeFile{
+		Version:  composeVersion,
+		Services: make(map[string]composeService)}
+
+	for _, p := range l {
+		c, err := d.instantiate(group, cfg, p, len(l))
+
+		if err != nil {
+			return nil, err
+		}
+
+		name := c.names
+
+		if len(name) == 0 {
+			name = fmt.Sprintf("%s-%d", sanitize(group), p.Ordinal)
+		}
+
+		r := c.HostConfig.Resources
+
+		s := composeService{
+			Image:          c.Image,
+			ContainerName:  c.names,
+			Hostname:       c.Hostname,
+			User:           c.User,
+			WorkingDir:     c.WorkingDir,
+			Entrypoint:     c.Entrypoint,
+			Command:        c.Cmd,
+			Environment:    c.Env,
+			Volumes:        c.HostConfig.Binds,
+			Labels:         c.Labels,
+			Cpuset:         r.CpusetCpus,
+			CPUShares:      r.CPUShares,
+			CPUQuota:       r.CPUQuota,
+			CPUPeriod:      r.CPUPeriod,
+			MemLimit:       r.Memory,
+			MemReservation: r.MemoryReservation,
+			PidsLimit:      r.PidsLimit,
+			CgroupParent:   r.CgroupParent,
+			Restart:        c.HostConfig.RestartPolicy.Name}
+
+		if r.BlkioWeight != 0 {
+			s.BlkioConfig = &composeBlkio{Weight: r.BlkioWeight}
+		}
+
+		for port, bindings := range c.HostConfig.PortBindings {
+			for _, b := range bindings {
+				s.Ports = append(s.Ports, binding(port, b))
+			}
+		}
+
+		for port := range c.ExposedPorts {
+			s.Expose = append(s.Expose, string(port))
+		}
+
+		// Port maps are unordered, but output should be stable.
+		sort.Strings(s.Ports)
+		sort.Strings(s.Expose)
+
+		switch mode := c.HostConfig.NetworkMode; {
+		case mode.IsUserDefined():
+			if f.Networks == nil {
+				f.Networks = make(map[string]composeExternal)
+			}
+
+			// Networks are managed outside of the compose project, same
+			// as they are with Tesson.
+			f.Networks[string(mode)] = composeExternal{External: true}
+
+			s.Networks = map[string]composeEndpoint{string(mode): {}}
+		case len(mode) != 0 && !mode.IsDefault():
+			s.NetworkMode = string(mode)
+		}
+
+		if c.NetworkingConfig != nil {
+			for network, e := range c.NetworkingConfig.EndpointsConfig {
+				if s.Networks == nil {
+					s.Networks = make(map[string]composeEndpoint)
+				}
+
+				if f.Networks == nil {
+					f.Networks = make(map[string]composeExternal)
+				}
+
+				f.Networks[network] = composeExternal{External: true}
+
+				v := composeEndpoint{Aliases: e.Aliases}
+
+				if e.IPAMConfig != nil {
+					v.IPv4Address = e.IPAMConfig.IPv4Address
+				}
+
+				s.Networks[network] = v
+			}
+		}
+
+		f.Services[name] = escape(s)
+	}
+
+	return yaml.Marshal(f)
+}
+
+// escape protects dollar signs from compose variable interpolation.
+func escape(s composeService) composeService {
+	r := strings.NewReplacer("$", "$$")
+
+	for _, l := range [][]string{s.Entrypoint, s.Command, s.Environment, s.Volumes} {
+		for i := range l {
+			l[i] = r.Replace(l[i])
+		}
+	}
+
+	for k, v := range s.Labels {
+		s.Labels[k] = r.Replace(v)
+	}
+
+	return s
+}
+
+// binding formats a port binding in the compose short syntax.
+func binding(port nat.Port, b nat.PortBinding) string {
+	var l []string
+
+	if len(b.HostIP) != 0 {
+		l = append(l, b.HostIP)
+	}
+
+	if len(b.HostPort) != 0 || len(l) != 0 {
+		l = append(l, b.HostPort)
+	}
+
+	return strings.Join(append(l, string(port)), ":")
+}
+
+// projectName is the compose project name, which is taken from the compose
+// file or the directory it's in, unless overridden in the environment.
+func projectName(name, dir string) string {
+	if env := os.Getenv("COMPOSE_PROJECT_NAME"); len(env) != 0 {
+		name = env
+	} else if len(name) == 0 {
+		name = filepath.Base(dir)
+	}
+
+	return strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-' {
+			return c
+		}
+
+		return -1
+	}, strings.ToLower(name))
+}
+
+// resource returns the actual name of a volume or network defined in the
+// compose file: either the one it's given explicitly, or the key itself for
+// external ones, or the key prefixed with the project name.
+func (p composeProject) resource(kind, key string, defined map[string]composeResource) (string, error) {
+	r, ok := defined[key]
+
+	if !ok {
+		return "", fmt.Errorf("%s [%s] is not defined", kind, key)
+	}
+
+	if len(r.Name) != 0 {
+		return r.Name, nil
+	}
+
+	switch e := r.External.(type) {
+	case bool:
+		if e {
+			return key, nil
+		}
+	case map[interface{}]interface{}:
+		if name, ok := e["name"]; ok {
+			return fmt.Sprint(name), nil
+		}
+
+		return key, nil
+	}
+
+	return p.name + "_" + key, nil
+}
+
+// source resolves a volume source: paths are made absolute, and names are
+// turned into actual volume names.
+func (p composeProject) source(source string, bind bool) (string, error) {
+	switch {
+	case filepath.IsAbs(source):
+		return source, nil
+	case source == "~" || strings.HasPrefix(source, "~/"):
+		return filepath.Join(os.Getenv("HOME"), source[1:]), nil
+	case bind || strings.HasPrefix(source, "."):
+		return filepath.Join(p.dir, source), nil
+	}
+
+	return p.resource("volume", source, p.volumes)
+}
+
+// network returns the actual name of a network the service is connected
+// to. The default network is implicit, same as in compose.
+func (p composeProject) network(key string) (string, error) {
+	if _, ok := p.networks[key]; !ok && key == "default" {
+		return p.name + "_default", nil
+	}
+
+	return p.resource("network", key, p.networks)
+}
+
+// config translates a compose service into a container config.
+func (src composeSource) config(p composeProject) (config, error) {
+	cfg := config{Config: container.Config{
+		Hostname:   src.Hostname,
+		User:       src.User,
+		WorkingDir: src.WorkingDir}}
+
+	if len(src.Entrypoint) != 0 {
+		cfg.Entrypoint = strslice.StrSlice(src.Entrypoint)
+	}
+
+	if len(src.Command) != 0 {
+		cfg.Cmd = strslice.StrSlice(src.Command)
+	}
+
+	for _, v := range src.Environment {
+		if strings.Contains(v, "=") {
+			cfg.Env = append(cfg.Env, v)
+		} else if value, ok := os.LookupEnv(v); ok {
+			// Taken from the environment, same as compose does.
+			cfg.Env = append(cfg.Env, v+"="+value)
+		}
+	}
+
+	if len(src.Labels) != 0 {
+		cfg.Labels = make(map[string]string)
+	}
+
+	for _, l := range src.Labels {
+		p := strings.SplitN(l, "=", 2)
+
+		if len(p) != 2 {
+			p = append(p, "")
+		}
+
+		cfg.Labels[p[0]] = p[1]
+	}
+
+	for _, p := range src.Expose {
+		if cfg.ExposedPorts == nil {
+			cfg.ExposedPorts = make(map[nat.Port]struct{})
+		}
+
+		port := fmt.Sprint(p)
+
+		if !strings.Contains(port, "/") {
+			port += "/tcp"
+		}
+
+		cfg.ExposedPorts[nat.Port(port)] = struct{}{}
+	}
+
+	for _, v := range src.Volumes {
+		if err := cfg.volume(v, p); err != nil {
+			return config{}, err
+		}
+	}
+
+	if h := src.Healthcheck; h != nil {
+		cfg.Healthcheck = &container.HealthConfig{Retries: h.Retries}
+
+		switch t := h.Test.(type) {
+		case nil:
+		case string:
+			// A plain string is a shell command, passed as is.
+			cfg.Healthcheck.Test = []string{"CMD-SHELL", t}
+		case []interface{}:
+			for _, item := range t {
+				cfg.Healthcheck.Test = append(cfg.Healthcheck.Test, fmt.Sprint(item))
+			}
+		default:
+			return config{}, fmt.Errorf("bad healthcheck test: %v", t)
+		}
+
+		if h.Disable {
+			cfg.Healthcheck.Test = []string{"NONE"}
+		}
+
+		var err error
+
+		if len(h.Interval) != 0 {
+			if cfg.Healthcheck.Interval, err = time.ParseDuration(h.Interval); err != nil {
+				return config{}, fmt.Errorf("healthcheck interval: %v", err)
+			}
+		}
+
+		if len(h.Timeout) != 0 {
+			if cfg.Healthcheck.Timeout, err = time.ParseDuration(h.Timeout); err != nil {
+				return config{}, fmt.Errorf("healthcheck timeout: %v", err)
+			}
+		}
+	}
+
+	hc := &cfg.HostConfig
+
+	hc.NetworkMode = container.NetworkMode(src.NetworkMode)
+	hc.RestartPolicy = container.RestartPolicy{Name: src.Restart}
+
+	if p := strings.SplitN(src.Restart, ":", 2); len(p) == 2 {
+		n, err := strconv.Atoi(p[1])
+
+		if err != nil {
+			return config{}, fmt.Errorf("bad restart policy: %s", src.Restart)
+		}
+
+		hc.RestartPolicy = container.RestartPolicy{Name: p[0], MaximumRetryCount: n}
+	}
+	hc.CapAdd = strslice.StrSlice(src.CapAdd)
+	hc.CapDrop = strslice.StrSlice(src.CapDrop)
+	hc.ExtraHosts = src.ExtraHosts
+	hc.Privileged = src.Privileged
+
+	endpoints := make(map[string]*network.EndpointSettings)
+
+	switch v := src.Networks.(type) {
+	case []interface{}:
+		for _, key := range v {
+			name, err := p.network(fmt.Sprint(key))
+
+			if err != nil {
+				return config{}, err
+			}
+
+			endpoints[name] = &network.EndpointSettings{}
+		}
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			name, err := p.network(fmt.Sprint(key))
+
+			if err != nil {
+				return config{}, err
+			}
+
+			e := &network.EndpointSettings{}
+
+			if m, ok := item.(map[interface{}]interface{}); ok {
+				if l, ok := m["aliases"].([]interface{}); ok {
+					for _, alias := range l {
+						e.Aliases = append(e.Aliases, fmt.Sprint(alias))
+					}
+				}
+
+				if ip, ok := m["ipv4_address"]; ok {
+					e.IPAMConfig = &network.EndpointIPAMConfig{IPv4Address: fmt.Sprint(ip)}
+				}
+			}
+
+			endpoints[name] = e
+		}
+	}
+
+	if len(endpoints) > 1 {
+		return config{}, errSeveralNetworks
+	}
+
+	for name, e := range endpoints {
+		hc.NetworkMode = container.NetworkMode(name)
+
+		if len(e.Aliases) != 0 || e.IPAMConfig != nil {
+			cfg.NetworkingConfig = &network.NetworkingConfig{
+				EndpointsConfig: endpoints}
+		}
+	}
+
+	return cfg, nil
+}
+
+// volume adds a compose volume, either in the short or the long syntax.
+func (cfg *config) volume(v interface{}, p composeProject) error {
+	var spec string
+
+	switch v := v.(type) {
+	case string:
+		parts := strings.SplitN(v, ":", 2)
+
+		if len(parts) == 1 {
+			spec = v
+			break
+		}
+
+		source, err := p.source(parts[0], false)
+
+		if err != nil {
+			return err
+		}
+
+		spec = source + ":" + parts[1]
+	case map[interface{}]interface{}:
+		spec = fmt.Sprint(v["target"])
+
+		if v["source"] != nil {
+			source, err := p.source(fmt.Sprint(v["source"]), v["type"] == "bind")
+
+			if err != nil {
+				return err
+			}
+
+			spec = source + ":" + spec
+		}
+
+		if ro, _ := v["read_only"].(bool); ro {
+			spec += ":ro"
+		}
+	default:
+		return fmt.Errorf("bad volume: %v", v)
+	}
+
+	if !strings.Contains(spec, ":") {
+		// Anonymous volume.
+		if cfg.Volumes == nil {
+			cfg.Volumes = make(map[string]struct{})
+		}
+
+		cfg.Volumes[spec] = struct{}{}
+
+		return nil
+	}
+
+	cfg.HostConfig.Binds = append(cfg.HostConfig.Binds, spec)
+
+	return nil
+}
+
+// appendPort adds a compose port, either in the short or the long syntax,
+// as a port spec.
+func appendPort(l []string, v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return append(l, v), nil
+	case int:
+		return append(l, fmt.Sprint(v)), nil
+	case map[interface{}]interface{}:
+		spec := fmt.Sprint(v["target"])
+
+		if published, ok := v["published"]; ok {
+			spec = fmt.Sprintf("%v:%s", published, spec)
+
+			if ip, ok := v["host_ip"]; ok {
+				spec = fmt.Sprintf("%v:%s", ip, spec)
+			}
+		}
+
+		if proto, ok := v["protocol"]; ok {
+			spec = fmt.Sprintf("%s/%v", spec, proto)
+		}
+
+		return append(l, spec), nil
+	}
+
+	return nil, fmt.Errorf("bad port: %v", v)
+}
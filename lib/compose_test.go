@@ -0,0 +1,230 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/docker/engine-api/types/container"
+	"github.com/docker/engine-api/types/strslice"
+)
+
+func TestParseCompose(t *testing.T) {
+	const file = `
+name: Shop
+services:
+  api:
+    image: example/api
+    command: serve --listen ':8080' "--name=api server"
+    environment:
+      B: "2"
+      A: "1"
+    ports:
+      - "9000-9099:8080"
+      - target: 9090
+        protocol: udp
+    volumes:
+      - ./data:/data:ro
+      - cache:/cache
+      - /tmp
+      - type: bind
+        source: /etc/api
+        target: /etc/api
+        read_only: true
+    networks:
+      back:
+        aliases: [api]
+    restart: on-failure:3
+    healthcheck:
+      test: curl -f 'http://localhost:8080/'
+      interval: 10s
+  web:
+    image: example/web
+    entrypoint: ["/bin/web", "-v"]
+    network_mode: host
+  mesh:
+    image: example/mesh
+    networks: [front, back]
+  lost:
+    image: example/lost
+    networks: [nowhere]
+volumes:
+  cache:
+networks:
+  back:
+  front:
+    external: true
+`
+
+	for _, c := range []struct {
+		service string
+		image   string
+		ports   []string
+		check   func(config) bool
+		fail    bool
+	}{
+		{service: "api", image: "example/api",
+			ports: []string{"9000-9099:8080", "9090/udp"},
+			check: func(cfg config) bool {
+				return reflect.DeepEqual(cfg.Cmd, strslice.StrSlice{
+					"serve", "--listen", ":8080", "--name=api server"}) &&
+					reflect.DeepEqual(cfg.Env, []string{"A=1", "B=2"}) &&
+					reflect.DeepEqual(cfg.HostConfig.Binds, []string{
+						"/srv/shop/data:/data:ro",
+						"shop_cache:/cache",
+						"/etc/api:/etc/api:ro"}) &&
+					reflect.DeepEqual(cfg.Volumes, map[string]struct{}{"/tmp": {}}) &&
+					cfg.HostConfig.NetworkMode == "shop_back" &&
+					cfg.NetworkingConfig != nil &&
+					reflect.DeepEqual(
+						cfg.NetworkingConfig.EndpointsConfig["shop_back"].Aliases,
+						[]string{"api"}) &&
+					cfg.HostConfig.RestartPolicy == container.RestartPolicy{
+						Name: "on-failure", MaximumRetryCount: 3} &&
+					reflect.DeepEqual(cfg.Healthcheck.Test, []string{
+						"CMD-SHELL", "curl -f 'http://localhost:8080/'"})
+			}},
+		{service: "web", image: "example/web",
+			check: func(cfg config) bool {
+				return reflect.DeepEqual(cfg.Entrypoint, strslice.StrSlice{"/bin/web", "-v"}) &&
+					cfg.HostConfig.NetworkMode == "host" &&
+					cfg.NetworkingConfig == nil
+			}},
+		{service: "mesh", fail: true},
+		{service: "lost", fail: true},
+		{service: "db", fail: true},
+	} {
+		spec, err := parseCompose([]byte(file), "/srv/shop", c.service)
+
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %+v", c.service, spec)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", c.service, err)
+			continue
+		}
+
+		if spec.Name != c.service || spec.Image != c.image {
+			t.Errorf("%s: got %s from %s", c.service, spec.Name, spec.Image)
+		}
+
+		if !reflect.DeepEqual(spec.Ports, c.ports) {
+			t.Errorf("%s: got ports %v, want %v", c.service, spec.Ports, c.ports)
+		}
+
+		var cfg config
+
+		if err := json.Unmarshal(spec.Config, &cfg); err != nil {
+			t.Errorf("%s: %v", c.service, err)
+		} else if !c.check(cfg) {
+			t.Errorf("%s: unexpected config %s", c.service, spec.Config)
+		}
+	}
+}
+
+func TestProjectName(t *testing.T) {
+	for _, c := range []struct {
+		name, dir string
+		want      string
+	}{
+		{name: "", dir: "/srv/shop", want: "shop"},
+		{name: "Shop", dir: "/srv/app", want: "shop"},
+		{name: "", dir: "/srv/My App.v2", want: "myappv2"},
+		{name: "web_2-x", dir: "/", want: "web_2-x"},
+	} {
+		if s := projectName(c.name, c.dir); s != c.want {
+			t.Errorf("%s in %s: got %s, want %s", c.name, c.dir, s, c.want)
+		}
+	}
+}
+
+func TestAppendPort(t *testing.T) {
+	for _, c := range []struct {
+		port interface{}
+		want string
+		fail bool
+	}{
+		{port: "8080:80", want: "8080:80"},
+		{port: 8080, want: "8080"},
+		{port: map[interface{}]interface{}{"target": 80}, want: "80"},
+		{port: map[interface{}]interface{}{"target": 80, "published": "9000-9099"},
+			want: "9000-9099:80"},
+		{port: map[interface{}]interface{}{
+			"target": 80, "published": 8080, "host_ip": "127.0.0.1", "protocol": "udp"},
+			want: "127.0.0.1:8080:80/udp"},
+		{port: 80.5, fail: true},
+	} {
+		l, err := appendPort([]string{"22"}, c.port)
+
+		if c.fail {
+			if err == nil {
+				t.Errorf("%v: expected an error, got %v", c.port, l)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: %v", c.port, err)
+		} else if want := []string{"22", c.want}; !reflect.DeepEqual(l, want) {
+			t.Errorf("%v: got %v, want %v", c.port, l, want)
+		}
+	}
+}
+
+func TestShellwords(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		want []string
+		fail bool
+	}{
+		{s: "", want: nil},
+		{s: "  serve   -v  ", want: []string{"serve", "-v"}},
+		{s: `sh -c 'echo  "$HOME"'`, want: []string{"sh", "-c", `echo  "$HOME"`}},
+		{s: `echo "a \"b\" \c" d\ e`, want: []string{"echo", `a "b" \c`, "d e"}},
+		{s: `a "" ''`, want: []string{"a", "", ""}},
+		{s: "a \\\nb", want: []string{"a", "b"}},
+		{s: `echo 'open`, fail: true},
+		{s: `echo "open`, fail: true},
+		{s: `echo \`, fail: true},
+	} {
+		l, err := shellwords(c.s)
+
+		if c.fail {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %q", c.s, l)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: %v", c.s, err)
+		} else if !reflect.DeepEqual(l, c.want) {
+			t.Errorf("%q: got %q, want %q", c.s, l, c.want)
+		}
+	}
+}
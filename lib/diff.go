@@ -0,0 +1,344 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/docker/engine-api/types/container"
+	"github.com/docker/go-connections/nat"
+)
+
+// Differ is implemented by runtimes which can detect configuration drift.
+type Differ interface {
+	Diff(group string, opts DiffOptions) ([]Drift, error)
+}
+
+// DiffOptions specifies options for Diff.
+type DiffOptions struct {
+	Target *ExecOptions // Desired state, the recorded one is used if nil.
+}
+
+// Drift describes a difference between the desired and the actual state of
+// a shard.
+type Drift struct {
+	Ordinal int    // Shard ordinal.
+	ID      string // Unique shard ID, empty if the shard is missing.
+	Kind    string // What's changed, e.g. "image" or "cpuset".
+	Want    string // Desired value.
+	Have    string // Actual value.
+}
+
+// Implementation
+
+// fingerprint captures the parts of the effective shard config which are
+// relevant for drift detection and survive a round trip through Docker.
+type fingerprint struct {
+	Image  string      // Image ID.
+	Env    []string    // Sorted, without variables inherited from the image.
+	Binds  []string    // Volume bindings.
+	Ports  nat.PortMap // Port bindings.
+	CPUs   string      // Cpuset.
+	Mems   string      // Memory nodes.
+	Memory int64       // Memory limit.
+	Shares int64       // CPU shares.
+
+	// Omitted if unset to keep hashes of shards spawned without a budget.
+	Quota  int64  `json:",omitempty"` // CFS quota.
+	Pids   int64  `json:",omitempty"` // Process limit.
+	IO     uint16 `json:",omitempty"` // Block IO weight.
+	Parent string `json:",omitempty"` // Parent cgroup.
+}
+
+func (f fingerprint) hash() string {
+	b, err := json.Marshal(f)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return revision(b)
+}
+
+// fingerprint computes a fingerprint given an image reference or ID.
+func (d *docker) fingerprint(
+	image string, env []string, hc *container.HostConfig) (fingerprint, error) {
+
+	i, _, err := d.client.ImageInspectWithRaw(d.ctx, image, false)
+
+	if err != nil {
+		return fingerprint{}, err
+	}
+
+	inherited := make(map[string]struct{})
+
+	if i.Config != nil {
+		for _, v := range i.Config.Env {
+			inherited[v] = struct{}{}
+		}
+	}
+
+	f := fingerprint{
+		Image:  i.ID,
+		Binds:  hc.Binds,
+		Ports:  hc.PortBindings,
+		CPUs:   hc.CpusetCpus,
+		Mems:   hc.CpusetMems,
+		Memory: hc.Memory,
+		Shares: hc.CPUShares,
+		Quota:  hc.CPUQuota,
+		Pids:   hc.PidsLimit,
+		IO:     hc.BlkioWeight,
+		Parent: hc.CgroupParent}
+
+	for _, v := range env {
+		if _, ok := inherited[v]; !ok {
+			f.Env = append(f.Env, v)
+		}
+	}
+
+	sort.Strings(f.Env)
+
+	return f, nil
+}
+
+func (d *docker) Diff(group string, opts DiffOptions) ([]Drift, error) {
+	i, err := d.Info(group)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg config
+
+	if opts.Target != nil {
+		cfg, err = d.configure(*opts.Target)
+	} else {
+		cfg, err = d.template(group)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		r     []Drift
+		n     = 0
+		known = make(map[int]bool)
+	)
+
+	if opts.Target != nil {
+		n = len(opts.Target.Layout)
+		cfg.quotas, cfg.layout = opts.Target.Quotas, opts.Target.Layout
+	} else {
+		n = len(i.Shards)
+
+		for _, shard := range i.Shards {
+			if shard.Ordinal >= n {
+				n = shard.Ordinal + 1
+			}
+
+			cfg.layout = append(cfg.layout, shard.Unit)
+		}
+	}
+
+	size := n
+
+	for _, shard := range i.Shards {
+		u := shard.Unit
+
+		if opts.Target != nil {
+			if shard.Ordinal < 0 || shard.Ordinal >= n {
+				r = append(r, Drift{Ordinal: shard.Ordinal, ID: shard.ID,
+					Kind: "extra", Have: shard.Unit.String()})
+				continue
+			}
+
+			u = opts.Target.Layout[shard.Ordinal]
+		}
+
+		if shard.Ordinal >= n {
+			n = shard.Ordinal + 1
+		}
+
+		known[shard.Ordinal] = true
+
+		l, err := d.drift(group, cfg, shard, u, size)
+
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, l...)
+	}
+
+	for ordinal := 0; ordinal < n; ordinal++ {
+		if !known[ordinal] {
+			r = append(r, Drift{Ordinal: ordinal, Kind: "missing"})
+		}
+	}
+
+	if opts.Target == nil {
+		r = append(r, outliers(i.Shards)...)
+	}
+
+	sort.Sort(byDrift(r))
+
+	return r, nil
+}
+
+// drift compares a shard against the desired config.
+func (d *docker) drift(
+	group string, cfg config, shard Shard, u Unit, n int) ([]Drift, error) {
+
+	c, err := d.instantiate(
+		group, cfg, Placement{Ordinal: shard.Ordinal, Unit: u}, n)
+
+	if err != nil {
+		return nil, err
+	}
+
+	want, err := d.fingerprint(c.Image, c.Env, &c.HostConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := d.client.ContainerInspect(d.ctx, shard.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	have, err := d.fingerprint(j.Image, j.Config.Env, j.HostConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var r []Drift
+
+	add := func(kind, want, have string) {
+		r = append(r, Drift{Ordinal: shard.Ordinal, ID: shard.ID,
+			Kind: kind, Want: want, Have: have})
+	}
+
+	if want.Image != have.Image {
+		add("image", want.Image, have.Image)
+	}
+
+	if want.CPUs != have.CPUs {
+		add("cpuset", want.CPUs, have.CPUs)
+	}
+
+	if !reflect.DeepEqual(want.Env, have.Env) {
+		removed, added := delta(want.Env, have.Env)
+
+		add("env", strings.Join(removed, " "), strings.Join(added, " "))
+	}
+
+	if len(r) != 0 {
+		return r, nil
+	}
+
+	// Something else has changed, e.g. resource limits.
+	if hash := j.Config.Labels["tesson.shard.hash"]; want.hash() != have.hash() ||
+		len(hash) != 0 && hash != want.hash() {
+		add("config", short(want.hash()), short(have.hash()))
+	}
+
+	return r, nil
+}
+
+// outliers reports shards spawned from a config different from the one
+// most of the group was spawned from.
+func outliers(shards []Shard) []Drift {
+	var (
+		top    string
+		counts = make(map[string]int)
+	)
+
+	for _, s := range shards {
+		if counts[s.Revision]++; counts[s.Revision] > counts[top] {
+			top = s.Revision
+		}
+	}
+
+	var r []Drift
+
+	for _, s := range shards {
+		if s.Revision != top {
+			r = append(r, Drift{Ordinal: s.Ordinal, ID: s.ID,
+				Kind: "revision", Want: short(top), Have: short(s.Revision)})
+		}
+	}
+
+	return r
+}
+
+// delta returns items only present in a and only present in b.
+func delta(a, b []string) ([]string, []string) {
+	m := make(map[string]int)
+
+	for _, v := range a {
+		m[v]--
+	}
+
+	for _, v := range b {
+		m[v]++
+	}
+
+	var l, r []string
+
+	for v, n := range m {
+		if n < 0 {
+			l = append(l, v)
+		} else if n > 0 {
+			r = append(r, v)
+		}
+	}
+
+	sort.Strings(l)
+	sort.Strings(r)
+
+	return l, r
+}
+
+func short(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+
+	return hash
+}
+
+type byDrift []Drift
+
+func (l byDrift) Len() int { return len(l) }
+func (l byDrift) Less(i, j int) bool {
+	if l[i].Ordinal != l[j].Ordinal {
+		return l[i].Ordinal < l[j].Ordinal
+	}
+
+	return l[i].Kind < l[j].Kind
+}
+func (l byDrift) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
@@ -19,9 +19,11 @@
 package tesson
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -32,6 +34,8 @@ import (
 	"github.com/docker/engine-api/types"
 	"github.com/docker/engine-api/types/container"
 	"github.com/docker/engine-api/types/filters"
+	"github.com/docker/engine-api/types/network"
+	"github.com/docker/engine-api/types/strslice"
 	"github.com/docker/go-connections/nat"
 
 	log "github.com/Sirupsen/logrus"
@@ -43,32 +47,84 @@ type RuntimeContext interface {
 	List() ([]Group, error)
 	Info(group string) (Group, error)
 	Stop(group string, opts StopOptions) error
+	Apply(group string, p Plan, opts StopOptions) ([]Shard, error)
+	Revision(opts ExecOptions) (string, error)
 }
 
 // Group represents runtime group status.
 type Group struct {
 	Name   string  // Human-readable group name.
 	Image  string  // Container image name.
+	Digest string  // Resolved image reference shards are spawned from.
+	Unit   string  // Binding unit of the layout, empty if not recorded.
 	Shards []Shard // Associated shards.
 }
 
 // Shard represents runtime shard status.
 type Shard struct {
-	Name   string // Human-readable shard name.
-	ID     string // Unique shard ID.
-	Status string // Status string.
-	Unit   Unit   // Hardware layout.
-	Ports  []types.Port
+	Name     string    // Human-readable shard name.
+	ID       string    // Unique shard ID.
+	Ordinal  int       // Shard ordinal within the group, or -1 if unknown.
+	State    string    // State, e.g. "running" or "exited".
+	Revision string    // Group config revision.
+	Digest   string    // Resolved image reference, empty if not pinned.
+	Hash     string    // Effective shard config hash.
+	Status   string    // Status string.
+	Created  time.Time // Creation time.
+	Unit     Unit      // Hardware layout.
+	Ports    []types.Port
+	IP       string // Directly routable address, empty if behind NAT.
+
+	// Detailed state, only reported by Inspect.
+	Health   string   // Health status, empty if there's no healthcheck.
+	Restarts int      // Number of restarts.
+	ExitCode int      // Exit code of the last run.
+	Mems     string   // Memory nodes.
+	Backends []string // Frontend registrations, filled by the caller.
+}
+
+// Dead reports whether the shard has terminated and won't be restarted.
+func (s Shard) Dead() bool {
+	return s.State == "exited" || s.State == "dead"
+}
+
+// Live reports whether the shard is running, or is about to run again, e.g.
+// restarting or paused. Shards which were created but never started are not
+// live.
+func (s Shard) Live() bool {
+	return !s.Dead() && s.State != "created"
 }
 
 // ExecOptions specifies options for Exec.
 type ExecOptions struct {
 	Image  string   // Container image name.
+	Args   []string // Command arguments, overriding the image default.
 	Layout []Unit   // Hardware layout.
+	Unit   string   // Binding unit the layout was distributed with.
 	Ports  []string // Exposed ports to publish.
 	Config string   // Container config file.
+	Inline []byte   // Container config, used instead of the file if set.
+	Pull   string   // Image pull policy, e.g. PullMissing.
+	Auth   string   // Registry credentials, "username:password".
+	Names  string   // Container name pattern, see DefaultNames.
+	Quotas Quotas   // Per-shard resource quotas.
+
+	// Overrides on top of the container config, same as in docker run.
+	Env        []string // Environment variables, "KEY=value".
+	Volumes    []string // Volume bindings.
+	Entrypoint string   // Entrypoint.
+	Network    string   // Network mode or user-defined network name.
+	Labels     []string // Container labels, "key=value".
+
+	// Attaches shards to a macvlan network named after Network, or after the
+	// group by default. The network is created if missing.
+	Macvlan *MacvlanOptions
 }
 
+// DefaultNames is the default container name pattern. It's a template which
+// has the same context as the container config.
+const DefaultNames = "{{.Group}}-{{.Ordinal}}"
+
 // StopOptions specifies options for Stop.
 type StopOptions struct {
 	Purge   bool          // Removes the container and its volumes.
@@ -77,90 +133,201 @@ type StopOptions struct {
 
 // Implementation
 
-// NewDockerContext constructs a new Docker-powered RuntimeContext.
-func NewDockerContext(ctx context.Context) (RuntimeContext, error) {
+// NewDockerContext constructs a new Docker-powered RuntimeContext, which only
+// manages groups of the given namespace.
+func NewDockerContext(ctx context.Context, ns Namespace) (RuntimeContext, error) {
+	if err := ns.validate(); err != nil {
+		return nil, err
+	}
+
 	r, err := client.NewEnvClient()
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &docker{ctx: ctx, client: r}, nil
+	return &docker{ctx: ctx, client: r, ns: ns}, nil
 }
 
 type docker struct {
 	ctx    context.Context
 	client *client.Client
+	ns     Namespace
 }
 
 type config struct {
 	container.Config
 	HostConfig container.HostConfig
+
+	// Omitted if unset to keep revisions of configs which have none.
+	NetworkingConfig *network.NetworkingConfig `json:",omitempty"`
+
+	// Resolved image reference, which all shards are spawned from. It's not
+	// a part of the config to keep revisions tag-based.
+	digest string
+
+	// Container name pattern, random names are used if empty.
+	names string
+
+	// Resource quotas, computed for each shard from its unit and the layout
+	// of the whole group.
+	quotas Quotas
+	layout []Unit
+
+	// How frontends reach shards, routingDirect or NAT if empty.
+	routing string
+
+	// Binding unit of the layout, so that the group is scaled and healed
+	// with the same granularity.
+	unit string
 }
 
 func (d *docker) Exec(group string, opts ExecOptions) (Group, error) {
-	cfg := config{Config: container.Config{Labels: map[string]string{}}}
+	l, err := d.List()
 
-	if len(opts.Config) != 0 {
-		b, err := ioutil.ReadFile(opts.Config)
+	if err != nil {
+		return Group{}, err
+	}
 
-		if err != nil {
+	if err := CheckGroup(group, l); err != nil {
+		return Group{}, err
+	}
+
+	var others []Group
+
+	for _, g := range l {
+		if g.Name != group {
+			others = append(others, g)
+		} else if err := d.sweep(g); err != nil {
 			return Group{}, err
 		}
+	}
 
-		if err := json.Unmarshal(b, &cfg); err != nil {
+	if err := d.ns.admit(others, cpus(opts.Layout)); err != nil {
+		return Group{}, err
+	}
+
+	cfg, err := d.prepare(group, opts)
+
+	if err != nil {
+		return Group{}, err
+	}
+
+	cfgs := make([]config, len(opts.Layout))
+
+	for i, u := range opts.Layout {
+		if cfgs[i], err = d.instantiate(
+			group, cfg, Placement{Ordinal: i, Unit: u}, len(opts.Layout),
+		); err != nil {
 			return Group{}, err
 		}
 	}
 
-	var bindings nat.PortMap
-
-	if cfg.HostConfig.PortBindings == nil && len(opts.Ports) > 0 {
-		bindings = make(nat.PortMap)
-	} else {
-		bindings = cfg.HostConfig.PortBindings
+	if err := unique(cfgs, nil); err != nil {
+		return Group{}, err
 	}
 
-	for _, p := range opts.Ports {
-		l, err := nat.ParsePortSpec(p)
+	if err := d.reserve(cfgs); err != nil {
+		return Group{}, err
+	}
 
-		if err != nil {
+	for _, c := range cfgs {
+		if _, err := d.spawn(group, c); err != nil {
 			return Group{}, err
 		}
+	}
 
-		for _, n := range l {
-			bindings[n.Port] = append(bindings[n.Port], n.Binding)
+	return d.Info(group)
+}
+
+// sweep removes shards left over by stopping a group without purging them,
+// so that they neither hold the names of new shards nor pass for a part of
+// the new group. Their volumes are kept. Groups with live shards are refused.
+func (d *docker) sweep(g Group) error {
+	for _, shard := range g.Shards {
+		if shard.Live() {
+			return fmt.Errorf("group [%s] already exists", g.Name)
 		}
 	}
 
-	cfg.Image = opts.Image
-	cfg.HostConfig.PortBindings = bindings
-	cfg.Labels["tesson.group"] = group
+	for _, shard := range g.Shards {
+		if err := d.client.ContainerRemove(
+			d.ctx, shard.ID, types.ContainerRemoveOptions{},
+		); err != nil {
+			return err
+		}
 
-	for i, u := range opts.Layout {
-		c := cfg // Copied for each unit to have a clean environment.
+		log.Infof("stopped instance removed: %v.", shard.ID)
+	}
 
-		c.HostConfig.Resources.CpusetCpus = u.String()
-		c.Labels["tesson.unit.cpuset"] = u.String()
-		c.Labels["tesson.unit.weight"] = strconv.Itoa(u.Weight())
+	return nil
+}
 
-		c.Env = append(c.Env, []string{
-			fmt.Sprintf("GOMAXPROCS=%d", u.Weight()),
-			fmt.Sprintf("TESSON_UID=%d", i)}...)
+// prepare builds the group config from options, pulling the image and
+// creating the macvlan network if necessary.
+func (d *docker) prepare(group string, opts ExecOptions) (config, error) {
+	if opts.Macvlan != nil && len(opts.Network) == 0 {
+		opts.Network = sanitize(d.ns.qualify(group)) // One network per group.
+	}
 
-		if err := d.exec(group, types.ContainerCreateConfig{
-			Config:     &c.Config,
-			HostConfig: &c.HostConfig}, opts,
-		); err != nil {
-			return Group{}, err
+	cfg, err := d.configure(opts)
+
+	if err != nil {
+		return config{}, err
+	}
+
+	if cfg.digest, err = d.resolve(cfg.Image, opts); err != nil {
+		return config{}, err
+	}
+
+	log.Infof("image resolved: %s.", cfg.digest)
+
+	if cfg.names = opts.Names; len(cfg.names) == 0 {
+		cfg.names = DefaultNames
+	}
+
+	if cfg.names == DefaultNames {
+		cfg.names = d.ns.qualify(cfg.names)
+	}
+
+	if err := opts.Quotas.validate(); err != nil {
+		return config{}, err
+	}
+
+	cfg.quotas, cfg.layout = opts.Quotas, opts.Layout
+	cfg.unit = opts.Unit
+
+	if opts.Macvlan != nil {
+		if err := d.macvlan(opts.Network, *opts.Macvlan); err != nil {
+			return config{}, err
 		}
+
+		cfg.routing = routingDirect
 	}
 
-	return d.Info(group)
+	return cfg, nil
+}
+
+func (d *docker) Revision(opts ExecOptions) (string, error) {
+	cfg, err := d.configure(opts)
+
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(cfg)
+
+	if err != nil {
+		return "", err
+	}
+
+	cfg.quotas = opts.Quotas
+
+	return cfg.revision(b), nil
 }
 
 func (d *docker) List() ([]Group, error) {
-	f := filters.NewArgs()
+	f := d.filter()
 	f.Add("label", "tesson.group")
 
 	l, err := d.client.ContainerList(d.ctx, types.ContainerListOptions{
@@ -175,13 +342,19 @@ func (d *docker) List() ([]Group, error) {
 	m := make(map[string]*Group)
 
 	for _, c := range l {
+		if !d.ns.owns(c.Labels) {
+			continue
+		}
+
 		var (
 			label = c.Labels["tesson.group"]
 			g     *Group
 		)
 
 		if g = m[label]; g == nil {
-			g = &Group{Name: label, Image: c.Image}
+			g = &Group{Name: label, Image: image(c),
+				Digest: c.Labels["tesson.group.digest"],
+				Unit:   c.Labels["tesson.group.unit"]}
 			m[label] = g
 		}
 
@@ -191,14 +364,17 @@ func (d *docker) List() ([]Group, error) {
 	var r []Group
 
 	for _, v := range m {
+		sort.Sort(byOrdinal(v.Shards))
 		r = append(r, *v)
 	}
 
+	sort.Sort(byName(r))
+
 	return r, nil
 }
 
 func (d *docker) Info(group string) (Group, error) {
-	f := filters.NewArgs()
+	f := d.filter()
 	f.Add("label", fmt.Sprintf("tesson.group=%s", group))
 
 	l, err := d.client.ContainerList(d.ctx, types.ContainerListOptions{
@@ -210,16 +386,22 @@ func (d *docker) Info(group string) (Group, error) {
 		return Group{}, err
 	}
 
+	l = d.owned(l)
+
 	if len(l) == 0 {
 		return Group{}, fmt.Errorf("group [%s] does not exist", group)
 	}
 
-	g := Group{Name: group, Image: l[0].Image}
+	g := Group{Name: group, Image: image(l[0]),
+		Digest: l[0].Labels["tesson.group.digest"],
+		Unit:   l[0].Labels["tesson.group.unit"]}
 
 	for _, c := range l {
 		g.Shards = append(g.Shards, d.convert(c))
 	}
 
+	sort.Sort(byOrdinal(g.Shards))
+
 	return g, nil
 }
 
@@ -239,22 +421,569 @@ func (d *docker) Stop(group string, opts StopOptions) error {
 	return nil
 }
 
-func (d *docker) exec(
-	group string, c types.ContainerCreateConfig, opts ExecOptions) error {
+func (d *docker) Apply(group string, p Plan, opts StopOptions) ([]Shard, error) {
+	var released, claimed []Unit
 
-	r, err := d.client.ContainerCreate(d.ctx,
-		c.Config, c.HostConfig, c.NetworkingConfig, c.Name)
+	// Shards which aren't live don't count towards the namespace cap, so
+	// removing them releases nothing.
+	for _, shard := range p.Remove {
+		if shard.Live() {
+			released = append(released, shard.Unit)
+		}
+	}
+
+	for _, placement := range p.Create {
+		claimed = append(claimed, placement.Unit)
+	}
+
+	if l, err := d.List(); err == nil {
+		if err := d.ns.admit(l, cpus(claimed)-cpus(released)); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+
+	var cfg config
+
+	if len(p.Create) > 0 {
+		var (
+			c   config
+			err error
+		)
+
+		if p.Options != nil {
+			c, err = d.prepare(group, *p.Options)
+		} else {
+			// Recovered up front, since removed shards might be the last
+			// ones to carry the group config.
+			c, err = d.template(group)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		cfg = c
+	}
+
+	cfg.layout = nil // Taken from the plan.
+
+	for _, shard := range p.Keep {
+		cfg.layout = append(cfg.layout, shard.Unit)
+	}
+
+	for _, placement := range p.Create {
+		cfg.layout = append(cfg.layout, placement.Unit)
+	}
+
+	// Shard configs are built before any shards are removed, so that a bad
+	// config or names pattern leaves the group intact.
+	cfgs := make([]config, len(p.Create))
+
+	for i, placement := range p.Create {
+		c, err := d.instantiate(
+			group, cfg, placement, len(p.Keep)+len(p.Create))
+
+		if err != nil {
+			return nil, err
+		}
+
+		cfgs[i] = c
+	}
+
+	if err := unique(cfgs, p.Keep); err != nil {
+		return nil, err
+	}
+
+	for _, shard := range p.Remove {
+		if err := d.stop(group, shard.ID, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(p.Create) == 0 {
+		return nil, nil
+	}
+
+	if err := d.reserve(cfgs); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]struct{})
+
+	for _, c := range cfgs {
+		id, err := d.spawn(group, c)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ids[id] = struct{}{}
+	}
+
+	i, err := d.Info(group)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var r []Shard
+
+	for _, shard := range i.Shards {
+		if _, ok := ids[shard.ID]; ok {
+			r = append(r, shard)
+		}
+	}
+
+	return r, nil
+}
+
+// configure builds the group config from options.
+func (d *docker) configure(opts ExecOptions) (config, error) {
+	cfg := config{Config: container.Config{Labels: map[string]string{}}}
+
+	b := opts.Inline
+
+	if len(b) == 0 && len(opts.Config) != 0 {
+		var err error
+
+		if b, err = ioutil.ReadFile(opts.Config); err != nil {
+			return config{}, err
+		}
+	}
+
+	if len(b) != 0 {
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return config{}, err
+		}
+	}
+
+	var bindings nat.PortMap
+
+	if cfg.HostConfig.PortBindings == nil && len(opts.Ports) > 0 {
+		bindings = make(nat.PortMap)
+	} else {
+		bindings = cfg.HostConfig.PortBindings
+	}
+
+	for _, p := range opts.Ports {
+		l, err := parsePortSpec(p)
+
+		if err != nil {
+			return config{}, err
+		}
+
+		for _, n := range l {
+			bindings[n.Port] = append(bindings[n.Port], n.Binding)
+		}
+	}
+
+	cfg.Image = opts.Image
+	cfg.HostConfig.PortBindings = bindings
+
+	if len(opts.Args) != 0 {
+		cfg.Cmd = strslice.StrSlice(opts.Args)
+	}
+
+	if opts.Macvlan != nil && len(bindings) != 0 {
+		// The host can't reach macvlan endpoints, so ports are exposed on
+		// shard addresses instead of being published.
+		if cfg.ExposedPorts == nil {
+			cfg.ExposedPorts = make(map[nat.Port]struct{})
+		}
+
+		for port := range bindings {
+			cfg.ExposedPorts[port] = struct{}{}
+		}
+
+		cfg.HostConfig.PortBindings = nil
+	}
+
+	if len(opts.Env) != 0 {
+		cfg.Env = override(cfg.Env, opts.Env)
+	}
+
+	cfg.HostConfig.Binds = append(cfg.HostConfig.Binds, opts.Volumes...)
+
+	if len(opts.Entrypoint) != 0 {
+		cfg.Entrypoint = strslice.StrSlice{opts.Entrypoint}
+	}
+
+	if len(opts.Network) != 0 {
+		cfg.HostConfig.NetworkMode = container.NetworkMode(opts.Network)
+	}
+
+	if cfg.Labels == nil && len(opts.Labels) != 0 {
+		cfg.Labels = make(map[string]string)
+	}
+
+	for _, l := range opts.Labels {
+		p := strings.SplitN(l, "=", 2)
+
+		if len(p) != 2 {
+			p = append(p, "")
+		}
+
+		cfg.Labels[p[0]] = p[1]
+	}
+
+	return cfg, nil
+}
+
+// override merges environment variables, replacing existing ones.
+func override(env, extra []string) []string {
+	var (
+		r   []string
+		idx = make(map[string]int)
+	)
+
+	for _, v := range append(env, extra...) {
+		k := strings.SplitN(v, "=", 2)[0]
+
+		if i, ok := idx[k]; ok {
+			r[i] = v
+			continue
+		}
+
+		idx[k] = len(r)
+		r = append(r, v)
+	}
+
+	return r
+}
+
+// template recovers the group config recorded at Exec time.
+func (d *docker) template(group string) (config, error) {
+	f := d.filter()
+	f.Add("label", fmt.Sprintf("tesson.group=%s", group))
+	f.Add("label", "tesson.group.config")
+
+	l, err := d.client.ContainerList(d.ctx, types.ContainerListOptions{
+		All:    true,
+		Filter: f,
+	})
+
+	if err != nil {
+		return config{}, err
+	}
+
+	l = d.owned(l)
+
+	if len(l) == 0 {
+		return d.legacy(group)
+	}
+
+	var cfg config
+
+	if err := json.Unmarshal(
+		[]byte(l[0].Labels["tesson.group.config"]), &cfg,
+	); err != nil {
+		return config{}, err
+	}
+
+	cfg.digest = l[0].Labels["tesson.group.digest"]
+	cfg.names = l[0].Labels["tesson.group.names"]
+	cfg.routing = l[0].Labels["tesson.group.routing"]
+	cfg.unit = l[0].Labels["tesson.group.unit"]
+
+	if v, ok := l[0].Labels["tesson.group.quotas"]; ok {
+		if err := json.Unmarshal([]byte(v), &cfg.quotas); err != nil {
+			return config{}, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// legacy rebuilds the group config of a group spawned before configs were
+// recorded, from one of its containers. Shards of such groups have no
+// ordinals, so scaling replaces all of them.
+func (d *docker) legacy(group string) (config, error) {
+	f := d.filter()
+	f.Add("label", fmt.Sprintf("tesson.group=%s", group))
+
+	l, err := d.client.ContainerList(d.ctx, types.ContainerListOptions{
+		All:    true,
+		Filter: f,
+	})
+
+	if err != nil {
+		return config{}, err
+	}
+
+	if l = d.owned(l); len(l) == 0 {
+		return config{}, fmt.Errorf("group [%s] has no recorded config", group)
+	}
+
+	j, err := d.client.ContainerInspect(d.ctx, l[0].ID)
+
+	if err != nil {
+		return config{}, err
+	}
+
+	cfg := config{Config: *j.Config, HostConfig: *j.HostConfig}
+
+	if cfg.Hostname == j.ID[:12] {
+		cfg.Hostname = "" // Assigned by Docker.
+	}
+
+	cfg.HostConfig.Resources.CpusetCpus = ""
+
+	// Added per shard when spawning.
+	for k := range cfg.Labels {
+		if strings.HasPrefix(k, "tesson.") {
+			delete(cfg.Labels, k)
+		}
+	}
+
+	cfg.Env = groupEnv(cfg.Env)
+
+	log.Warnf("group [%s] has no recorded config, using the one of %.12s.",
+		group, j.ID)
+
+	return cfg, nil
+}
+
+// unique checks that shard configs have distinct container names, e.g. that
+// the names pattern refers to the ordinal, so that a group is never left
+// half-created because of a name conflict. Kept shards hold their names.
+func unique(cfgs []config, kept []Shard) error {
+	names := make(map[string]struct{})
+
+	for _, shard := range kept {
+		for _, name := range strings.Split(shard.Name, "; ") {
+			names[strings.TrimPrefix(name, "/")] = struct{}{}
+		}
+	}
+
+	for _, c := range cfgs {
+		if len(c.names) == 0 {
+			continue // Generated by Docker.
+		}
+
+		if _, ok := names[c.names]; ok {
+			return fmt.Errorf(
+				"container name %s is used by several shards, names pattern should refer to {{.Ordinal}}",
+				c.names)
+		}
+
+		names[c.names] = struct{}{}
+	}
+
+	return nil
+}
+
+// reserve checks host ports published by shard configs. Ports published by
+// running containers are looked up via Docker, since they might be held by
+// docker-proxy or only exist as NAT rules.
+func (d *docker) reserve(cfgs []config) error {
+	m := make(map[int][]types.Port)
+
+	for _, c := range cfgs {
+		n, _ := strconv.Atoi(c.Labels["tesson.shard.ordinal"])
+		m[n] = published(c.HostConfig.PortBindings)
+	}
+
+	l, err := d.client.ContainerList(d.ctx, types.ContainerListOptions{})
 
 	if err != nil {
 		return err
 	}
 
-	log.Infof("instance created: %v.", r.ID)
+	taken := make(map[string]string)
+
+	for _, c := range l {
+		owner := fmt.Sprintf("container %.12s", c.ID)
+
+		if len(c.Names) != 0 {
+			owner = fmt.Sprintf("container %s", strings.TrimPrefix(c.Names[0], "/"))
+		}
+
+		for _, p := range c.Ports {
+			if p.PublicPort != 0 {
+				taken[fmt.Sprintf("%d/%s", p.PublicPort, p.Type)] = owner
+			}
+		}
+	}
+
+	return reserve(m, taken)
+}
+
+// spawn creates a shard container and starts it.
+func (d *docker) spawn(group string, c config) (string, error) {
+	id, err := d.create(group, c)
+
+	if err != nil {
+		return "", err
+	}
 
 	if err := d.client.ContainerStart(
-		d.ctx, r.ID, types.ContainerStartOptions{},
+		d.ctx, id, types.ContainerStartOptions{},
 	); err != nil {
-		return err
+		return "", err
+	}
+
+	return id, nil
+}
+
+// create creates a shard container without starting it.
+func (d *docker) create(group string, c config) (string, error) {
+	f, err := d.fingerprint(c.Image, c.Env, &c.HostConfig)
+
+	if err != nil {
+		return "", err
+	}
+
+	c.Labels["tesson.shard.hash"] = f.hash()
+
+	r, err := d.client.ContainerCreate(d.ctx,
+		&c.Config, &c.HostConfig, c.NetworkingConfig, c.names)
+
+	if err != nil {
+		return "", err
+	}
+
+	log.Infof("instance created: %v.", r.ID)
+
+	return r.ID, nil
+}
+
+// instantiate builds a shard config from the group config, which consists
+// of n shards.
+func (d *docker) instantiate(
+	group string, cfg config, p Placement, n int) (config, error) {
+
+	b, err := json.Marshal(cfg)
+
+	if err != nil {
+		return config{}, err
+	}
+
+	// Decoded from scratch to have a deep copy for each unit, since
+	// templates are rendered in place.
+	var c config
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return config{}, err
+	}
+
+	ctx := ShardContext{
+		Group:   group,
+		Ordinal: p.Ordinal,
+		Size:    n,
+		CPUSet:  p.Unit.String(),
+		Node:    p.Unit.Node(),
+		Weight:  p.Unit.Weight()}
+
+	if err := render(&c, ctx); err != nil {
+		return config{}, fmt.Errorf("config template: %v", err)
+	}
+
+	if c.names = cfg.names; len(c.names) != 0 {
+		if err := render(&c.names, ctx); err != nil {
+			return config{}, fmt.Errorf("name template: %v", err)
+		}
+
+		c.names = sanitize(c.names)
+	}
+
+	if err := cfg.quotas.apply(
+		&c.HostConfig.Resources, p.Unit, cfg.layout,
+	); err != nil {
+		return config{}, err
+	}
+
+	c.HostConfig.Resources.CpusetCpus = p.Unit.String()
+
+	if err := d.label(&c, group, cfg, b, p); err != nil {
+		return config{}, err
+	}
+
+	if len(cfg.digest) != 0 {
+		c.Image = cfg.digest
+	}
+
+	c.Env = append(c.Env, shardEnv(p)...)
+
+	return c, nil
+}
+
+// shardEnv returns variables which every shard gets on top of the config.
+func shardEnv(p Placement) []string {
+	return []string{
+		fmt.Sprintf("GOMAXPROCS=%d", p.Unit.Weight()),
+		fmt.Sprintf("TESSON_UID=%d", p.Ordinal)}
+}
+
+// groupEnv leaves out variables which are set per shard, see shardEnv.
+func groupEnv(env []string) []string {
+	var r []string
+
+	for _, v := range env {
+		if !strings.HasPrefix(v, "GOMAXPROCS=") && !strings.HasPrefix(v, "TESSON_UID=") {
+			r = append(r, v)
+		}
+	}
+
+	return r
+}
+
+// label records the group config, given its serialized form, and the shard
+// placement in container labels.
+func (d *docker) label(
+	c *config, group string, cfg config, b []byte, p Placement) error {
+
+	if c.Labels == nil {
+		c.Labels = make(map[string]string)
+	}
+
+	c.Labels["tesson.group"] = group
+
+	if len(d.ns.Name) != 0 {
+		c.Labels["tesson.namespace"] = d.ns.Name
+	}
+
+	c.Labels["tesson.group.config"] = string(b)
+	c.Labels["tesson.group.revision"] = cfg.revision(b)
+	c.Labels["tesson.group.image"] = cfg.Image
+	c.Labels["tesson.shard.ordinal"] = strconv.Itoa(p.Ordinal)
+	c.Labels["tesson.unit.cpuset"] = p.Unit.String()
+	c.Labels["tesson.unit.weight"] = strconv.Itoa(p.Unit.Weight())
+	c.Labels["tesson.unit.node"] = strconv.Itoa(p.Unit.Node())
+	c.Labels["tesson.unit.memory"] = strconv.FormatInt(p.Unit.Memory(), 10)
+	c.Labels["tesson.unit.socket"] = strconv.Itoa(p.Unit.Socket())
+
+	if len(cfg.names) != 0 {
+		c.Labels["tesson.group.names"] = cfg.names
+	}
+
+	if len(cfg.routing) != 0 {
+		c.Labels["tesson.group.routing"] = cfg.routing
+	}
+
+	if len(cfg.unit) != 0 {
+		c.Labels["tesson.group.unit"] = cfg.unit
+	}
+
+	if !cfg.quotas.empty() {
+		if b, err := json.Marshal(cfg.quotas); err == nil {
+			c.Labels["tesson.group.quotas"] = string(b)
+		} else {
+			return err
+		}
+	}
+
+	if ports := published(c.HostConfig.PortBindings); len(ports) != 0 {
+		if b, err := json.Marshal(ports); err == nil {
+			c.Labels["tesson.shard.ports"] = string(b)
+		} else {
+			return err
+		}
+	}
+
+	if len(cfg.digest) != 0 {
+		c.Labels["tesson.group.digest"] = cfg.digest
 	}
 
 	return nil
@@ -290,8 +1019,11 @@ func (d *docker) stop(group, id string, opts StopOptions) error {
 }
 
 type unitInfo struct {
-	CPUSet string
-	NumCPU int
+	CPUSet   string
+	NumCPU   int
+	NodeID   int
+	MemSize  int64
+	SocketID int
 }
 
 func (u unitInfo) String() string {
@@ -302,19 +1034,174 @@ func (u unitInfo) Weight() int {
 	return u.NumCPU
 }
 
+func (u unitInfo) Node() int {
+	return u.NodeID
+}
+
+func (u unitInfo) Memory() int64 {
+	return u.MemSize
+}
+
+func (u unitInfo) Socket() int {
+	return u.SocketID
+}
+
+// filter returns container filters for the namespace. Containers of the
+// default namespace can't be told apart by filters, see owned.
+func (d *docker) filter() filters.Args {
+	f := filters.NewArgs()
+
+	if len(d.ns.Name) != 0 {
+		f.Add("label", fmt.Sprintf("tesson.namespace=%s", d.ns.Name))
+	}
+
+	return f
+}
+
+// owned drops containers of other namespaces.
+func (d *docker) owned(l []types.Container) []types.Container {
+	var r []types.Container
+
+	for _, c := range l {
+		if d.ns.owns(c.Labels) {
+			r = append(r, c)
+		}
+	}
+
+	return r
+}
+
+// image returns the image name a container was spawned from, as opposed to
+// the resolved reference Docker reports.
+func image(c types.Container) string {
+	if name, ok := c.Labels["tesson.group.image"]; ok {
+		return name
+	}
+
+	return c.Image
+}
+
 func (d *docker) convert(c types.Container) Shard {
-	w, err := strconv.Atoi(c.Labels["tesson.unit.weight"])
+	u := &unitInfo{CPUSet: c.Labels["tesson.unit.cpuset"]}
+
+	var err error
+
+	if u.NumCPU, err = strconv.Atoi(c.Labels["tesson.unit.weight"]); err != nil {
+		u.NumCPU = ncpu(u.CPUSet) // Labelled by hand.
+	}
+
+	if u.NodeID, err = strconv.Atoi(c.Labels["tesson.unit.node"]); err != nil {
+		u.NodeID = -1
+	}
+
+	// Zero for shards created by an older version.
+	u.MemSize, _ = strconv.ParseInt(c.Labels["tesson.unit.memory"], 10, 64)
+
+	if u.SocketID, err = strconv.Atoi(c.Labels["tesson.unit.socket"]); err != nil {
+		u.SocketID = -1
+	}
+
+	n, err := strconv.Atoi(c.Labels["tesson.shard.ordinal"])
 
 	if err != nil {
-		panic(err)
+		n = -1 // Created by an older version.
+	}
+
+	ports := c.Ports
+
+	if v, ok := c.Labels["tesson.shard.ports"]; ok {
+		var l []types.Port
+
+		if err := json.Unmarshal([]byte(v), &l); err == nil {
+			ports = allocated(l, c.Ports)
+		}
 	}
 
-	u := &unitInfo{CPUSet: c.Labels["tesson.unit.cpuset"], NumCPU: w}
+	var ip string
+
+	if c.Labels["tesson.group.routing"] == routingDirect {
+		ip = address(c)
+	}
 
 	return Shard{
-		Name:   strings.Join(c.Names, "; "),
-		ID:     c.ID,
-		Status: c.Status,
-		Unit:   u,
-		Ports:  c.Ports}
+		Name:     strings.Join(c.Names, "; "),
+		ID:       c.ID,
+		Ordinal:  n,
+		State:    c.State,
+		Revision: c.Labels["tesson.group.revision"],
+		Digest:   c.Labels["tesson.group.digest"],
+		Hash:     c.Labels["tesson.shard.hash"],
+		Status:   c.Status,
+		Created:  time.Unix(c.Created, 0),
+		Unit:     u,
+		Ports:    ports,
+		IP:       ip}
+}
+
+// ncpu counts CPUs in a cpuset list, e.g. "0-3,8", or returns zero if it
+// can't be parsed.
+func ncpu(cpuset string) int {
+	var n int
+
+	for _, r := range strings.Split(cpuset, ",") {
+		p := strings.SplitN(strings.TrimSpace(r), "-", 2)
+
+		lo, err := strconv.Atoi(p[0])
+
+		if err != nil {
+			return 0
+		}
+
+		hi := lo
+
+		if len(p) == 2 {
+			if hi, err = strconv.Atoi(p[1]); err != nil || hi < lo {
+				return 0
+			}
+		}
+
+		n += hi - lo + 1
+	}
+
+	return n
+}
+
+// sanitize replaces characters not allowed in container names.
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '_', r == '.', r == '-':
+			return r
+		default:
+			return '-'
+		}
+	}, name)
+}
+
+// revision computes the group config revision given its serialized form.
+// Quotas are not a part of the config, but changing them makes a new one.
+func (c config) revision(b []byte) string {
+	if c.quotas.empty() {
+		return revision(b) // Compatible with groups spawned without quotas.
+	}
+
+	q, err := json.Marshal(c.quotas)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return revision(append(b, q...))
+}
+
+type byName []Group
+
+func (l byName) Len() int           { return len(l) }
+func (l byName) Less(i, j int) bool { return l[i].Name < l[j].Name }
+func (l byName) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+func revision(b []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(b))
 }
@@ -0,0 +1,91 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNcpu(t *testing.T) {
+	for _, c := range []struct {
+		cpuset string
+		want   int
+	}{
+		{cpuset: "0", want: 1},
+		{cpuset: "0-3", want: 4},
+		{cpuset: "0-3,8", want: 5},
+		{cpuset: "0-1, 4-5,7", want: 5},
+		{cpuset: "", want: 0},
+		{cpuset: "3-1", want: 0},
+		{cpuset: "0-", want: 0},
+		{cpuset: "cpu0", want: 0},
+	} {
+		if n := ncpu(c.cpuset); n != c.want {
+			t.Errorf("%q: got %d, want %d", c.cpuset, n, c.want)
+		}
+	}
+}
+
+func TestShardEnv(t *testing.T) {
+	p := Placement{Ordinal: 3, Unit: unitInfo{CPUSet: "4-5", NumCPU: 2}}
+	env := []string{"A=1", "GOMAXPROCS=8", "TESSON_UID=0", "B=2"}
+
+	if l := groupEnv(env); !reflect.DeepEqual(l, []string{"A=1", "B=2"}) {
+		t.Errorf("group env: got %v", l)
+	}
+
+	want := []string{"A=1", "B=2", "GOMAXPROCS=2", "TESSON_UID=3"}
+
+	if l := append(groupEnv(env), shardEnv(p)...); !reflect.DeepEqual(l, want) {
+		t.Errorf("shard env: got %v, want %v", l, want)
+	}
+}
+
+func TestUnique(t *testing.T) {
+	kept := []Shard{{Name: "/api-0"}}
+
+	for _, c := range []struct {
+		name  string
+		names []string
+		kept  []Shard
+		fail  bool
+	}{
+		{name: "distinct", names: []string{"api-0", "api-1"}},
+		{name: "generated", names: []string{"", ""}},
+		{name: "same", names: []string{"api", "api"}, fail: true},
+		{name: "kept", names: []string{"api-1"}, kept: kept},
+		{name: "taken by kept", names: []string{"api-0"}, kept: kept, fail: true},
+	} {
+		var cfgs []config
+
+		for _, name := range c.names {
+			cfgs = append(cfgs, config{names: name})
+		}
+
+		err := unique(cfgs, c.kept)
+
+		switch {
+		case c.fail && err == nil:
+			t.Errorf("%s: expected an error", c.name)
+		case !c.fail && err != nil:
+			t.Errorf("%s: %v", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/docker/engine-api/types"
+	"github.com/docker/engine-api/types/events"
+)
+
+var (
+	errEventStreamClosed = errors.New("event stream closed")
+)
+
+// Watcher is implemented by runtimes which can report shard lifecycle events.
+type Watcher interface {
+	Watch(since time.Time, fn func(Event) error) error
+}
+
+// Event represents a shard lifecycle event.
+type Event struct {
+	Group  string    // Group name.
+	Shard  string    // Unique shard ID.
+	Action string    // Event type, e.g. "start", "die" or "destroy".
+	Time   time.Time // Event timestamp.
+}
+
+// Implementation
+
+func (d *docker) Watch(since time.Time, fn func(Event) error) error {
+	f := d.filter()
+	f.Add("type", events.ContainerEventType)
+	f.Add("label", "tesson.group")
+
+	for _, action := range []string{"start", "die", "destroy"} {
+		f.Add("event", action)
+	}
+
+	opts := types.EventsOptions{Filters: f}
+
+	if !since.IsZero() {
+		opts.Since = strconv.FormatInt(since.Unix(), 10)
+	}
+
+	r, err := d.client.Events(d.ctx, opts)
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	dec := json.NewDecoder(r)
+
+	for {
+		var m events.Message
+
+		if err := dec.Decode(&m); err == io.EOF {
+			return errEventStreamClosed
+		} else if err != nil {
+			return err
+		}
+
+		e := Event{
+			Group:  m.Actor.Attributes["tesson.group"],
+			Shard:  m.Actor.ID,
+			Action: m.Action,
+			Time:   time.Unix(0, m.TimeNano)}
+
+		if len(e.Action) == 0 {
+			e.Action = m.Status // Older daemons.
+		}
+
+		if len(e.Shard) == 0 {
+			e.Shard = m.ID
+		}
+
+		if m.TimeNano == 0 {
+			e.Time = time.Unix(m.Time, 0)
+		}
+
+		if !d.ns.owns(m.Actor.Attributes) {
+			continue
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/docker/engine-api/types"
+)
+
+// Executor is implemented by runtimes which can run commands in shards.
+type Executor interface {
+	Execute(shard Shard, cmd []string) (Result, error)
+}
+
+// Result describes a finished command.
+type Result struct {
+	Stdout   []byte // Standard output.
+	Stderr   []byte // Standard error.
+	ExitCode int    // Exit code.
+}
+
+// Implementation
+
+func (d *docker) Execute(shard Shard, cmd []string) (Result, error) {
+	cfg := types.ExecConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd}
+
+	e, err := d.client.ContainerExecCreate(d.ctx, shard.ID, cfg)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	h, err := d.client.ContainerExecAttach(d.ctx, e.ID, cfg)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	defer h.Close()
+
+	var stdout, stderr bytes.Buffer
+
+	if err := frames(h.Reader, func(stream string, p []byte) error {
+		var w io.Writer = &stdout
+
+		if stream == "stderr" {
+			w = &stderr
+		}
+
+		_, err := w.Write(p)
+
+		return err
+	}); err != nil {
+		return Result{}, err
+	}
+
+	// Streams might be closed slightly before the process is reaped.
+	for {
+		i, err := d.client.ContainerExecInspect(d.ctx, e.ID)
+
+		if err != nil {
+			return Result{}, err
+		}
+
+		if !i.Running {
+			return Result{
+				Stdout:   stdout.Bytes(),
+				Stderr:   stderr.Bytes(),
+				ExitCode: i.ExitCode}, nil
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
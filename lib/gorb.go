@@ -20,12 +20,14 @@ package tesson
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
 
 	"github.com/docker/engine-api/types"
@@ -40,12 +42,20 @@ import (
 type Frontend interface {
 	CreateService(group string, shards []Shard) error
 	RemoveService(group string, shards []Shard) error
+	RemoveBackends(group string, shards []Shard) error
+}
+
+// Registry is implemented by frontends which can report shard registrations.
+type Registry interface {
+	Backends(group string, shards []Shard) (map[string][]string, error)
 }
 
 // Implementation
 
-// NewGorbFrontend constructs a new Frontend powered by Gorb.
-func NewGorbFrontend(uri string) (Frontend, error) {
+// NewGorbFrontend constructs a new Frontend powered by Gorb. Services are
+// registered per namespace, so that groups of different namespaces sharing
+// the same name are kept apart.
+func NewGorbFrontend(uri string, ns Namespace) (Frontend, error) {
 	// URI is "device://host:port", e.g. "eth1://1.2.3.4:4872"
 	u, err := url.Parse(uri)
 
@@ -53,7 +63,16 @@ func NewGorbFrontend(uri string) (Frontend, error) {
 		return nil, err
 	}
 
-	g := &gorb{cache: make(map[string]struct{})}
+	g := &gorb{cache: make(map[string]struct{}), method: defaultDirectMethod,
+		ns: ns}
+
+	if m := u.Query().Get("method"); len(m) != 0 {
+		g.method = strings.ToLower(m)
+	}
+
+	if !gorbMethods[g.method] {
+		return nil, fmt.Errorf("unknown forwarding method: %s", g.method)
+	}
 
 	if addrs, err := util.InterfaceIPs(u.Scheme); err == nil {
 		g.hostIPs = addrs
@@ -66,20 +85,27 @@ func NewGorbFrontend(uri string) (Frontend, error) {
 	return g, nil
 }
 
+// Forwarding method for shards with directly routable addresses. Tunneling
+// keeps the client address and lets shards reply directly, but requires them
+// to decapsulate IP-in-IP traffic for the service address. NAT requires them
+// to route replies back through the host instead.
+const defaultDirectMethod = "tunnel"
+
+// Forwarding methods Gorb accepts.
+var gorbMethods = map[string]bool{"nat": true, "tunnel": true, "ipip": true}
+
 type gorb struct {
 	cache   map[string]struct{}
 	hostIPs []net.IP
 	url     *url.URL
+	method  string
+	ns      Namespace
 }
 
 func (g *gorb) CreateService(group string, shards []Shard) error {
 	for _, shard := range shards {
-		for _, port := range shard.Ports {
-			if port.PublicPort == 0 || port.PrivatePort == 0 {
-				continue
-			}
-
-			vsID := g.mangle(group, port)
+		for _, port := range g.ports(shard) {
+			vsID := g.mangle(g.ns.qualify(group), port)
 
 			if _, ok := g.cache[vsID]; !ok {
 				if err := g.createService(vsID, port); err != nil {
@@ -91,7 +117,7 @@ func (g *gorb) CreateService(group string, shards []Shard) error {
 
 			rsID := g.mangle(shard.ID, port)
 
-			if err := g.createBackend(vsID, rsID, port); err != nil {
+			if err := g.createBackend(vsID, rsID, shard, port); err != nil {
 				return err
 			}
 		}
@@ -124,17 +150,25 @@ func (g *gorb) createService(vsID string, p types.Port) error {
 }
 
 type backendRequest struct {
-	Host  string         `json:"host"`
-	Port  uint           `json:"port"`
-	Pulse *pulse.Options `json:"pulse"`
+	Host   string         `json:"host"`
+	Port   uint           `json:"port"`
+	Method string         `json:"method,omitempty"`
+	Pulse  *pulse.Options `json:"pulse"`
 }
 
-func (g *gorb) createBackend(vsID, rsID string, p types.Port) error {
+func (g *gorb) createBackend(
+	vsID, rsID string, shard Shard, p types.Port) error {
+
 	log.Infof("registering shard: %s/%s.", vsID, rsID)
 
 	request := backendRequest{
 		Host: p.IP, Port: uint(p.PublicPort)}
 
+	if len(shard.IP) != 0 {
+		request = backendRequest{
+			Host: shard.IP, Port: uint(p.PrivatePort), Method: g.method}
+	}
+
 	if p.Type == "udp" {
 		// Disable health checks for UDP-based services.
 		request.Pulse = &pulse.Options{Type: "none"}
@@ -164,12 +198,8 @@ func (g *gorb) RemoveService(group string, shards []Shard) error {
 	vsIDs := map[string]struct{}{}
 
 	for _, shard := range shards {
-		for _, port := range shard.Ports {
-			if port.PublicPort == 0 || port.PrivatePort == 0 {
-				continue
-			}
-
-			vsIDs[g.mangle(group, port)] = struct{}{}
+		for _, port := range g.ports(shard) {
+			vsIDs[g.mangle(g.ns.qualify(group), port)] = struct{}{}
 		}
 	}
 
@@ -195,20 +225,187 @@ func (g *gorb) RemoveService(group string, shards []Shard) error {
 	return nil
 }
 
+type serviceInfo struct {
+	Backends []string `json:"backends"`
+}
+
+func (g *gorb) RemoveBackends(group string, shards []Shard) error {
+	if len(shards) == 0 {
+		return nil
+	}
+
+	m, err := g.Backends(group, shards)
+
+	if err != nil {
+		return err
+	}
+
+	for _, l := range m {
+		for _, id := range l {
+			p := strings.SplitN(id, "/", 2)
+
+			if err := g.removeBackend(p[0], p[1]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Backends returns registrations of shards, as "vsID/rsID", by shard ID.
+func (g *gorb) Backends(
+	group string, shards []Shard) (map[string][]string, error) {
+
+	// Stopped shards don't expose any ports, so backends are looked up
+	// among the registered group services instead.
+	vsIDs, err := g.services(group)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		u = *g.url
+		m = make(map[string][]string)
+	)
+
+	for _, vsID := range vsIDs {
+		var info serviceInfo
+
+		u.Path = path.Join("service", vsID)
+		r, _ := http.NewRequest("GET", u.String(), nil)
+
+		if err := g.exchange(r, &info, errorDispatch{
+			http.StatusNotFound: func() error {
+				return fmt.Errorf("service [%s] does not exist", vsID)
+			}},
+		); err != nil {
+			return nil, err
+		}
+
+		for _, rsID := range info.Backends {
+			for _, shard := range shards {
+				if strings.HasPrefix(rsID, g.escape(shard.ID)+"-") {
+					m[shard.ID] = append(m[shard.ID], vsID+"/"+rsID)
+				}
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func (g *gorb) removeBackend(vsID, rsID string) error {
+	log.Infof("withdrawing shard registration: %s/%s.", vsID, rsID)
+
+	u := *g.url
+	u.Path = path.Join("service", vsID, rsID)
+
+	r, _ := http.NewRequest("DELETE", u.String(), nil)
+
+	return g.roundtrip(r, errorDispatch{
+		http.StatusNotFound: func() error {
+			return nil // already gone.
+		}})
+}
+
+// services returns IDs of all registered virtual services of a group.
+func (g *gorb) services(group string) ([]string, error) {
+	var l []string
+
+	u := *g.url
+	u.Path = "service"
+
+	r, _ := http.NewRequest("GET", u.String(), nil)
+
+	if err := g.exchange(r, &l, errorDispatch{}); err != nil {
+		return nil, err
+	}
+
+	var (
+		vsIDs  []string
+		prefix = g.escape(g.ns.qualify(group)) + "-"
+	)
+
+	for _, vsID := range l {
+		if !strings.HasPrefix(vsID, prefix) {
+			continue
+		}
+
+		// Skip services of other groups sharing the same prefix.
+		p := strings.Split(strings.TrimPrefix(vsID, prefix), "-")
+
+		if len(p) != 2 {
+			continue
+		}
+
+		if _, err := strconv.Atoi(p[0]); err == nil {
+			vsIDs = append(vsIDs, vsID)
+		}
+	}
+
+	return vsIDs, nil
+}
+
+// ports returns shard ports to load balance: published ones for shards
+// behind NAT, or exposed ones for shards with routable addresses.
+func (g *gorb) ports(shard Shard) []types.Port {
+	var (
+		r    []types.Port
+		seen = make(map[string]struct{})
+	)
+
+	for _, port := range shard.Ports {
+		if port.PrivatePort == 0 {
+			continue
+		}
+
+		if len(shard.IP) == 0 {
+			if port.PublicPort != 0 {
+				r = append(r, port)
+			}
+
+			continue
+		}
+
+		// Ports published on several host addresses are listed several times.
+		k := fmt.Sprintf("%d/%s", port.PrivatePort, port.Type)
+
+		if _, ok := seen[k]; !ok {
+			seen[k] = struct{}{}
+			r = append(r, port)
+		}
+	}
+
+	return r
+}
+
 func (g *gorb) mangle(id string, p types.Port) string {
-	return fmt.Sprintf("%s-%d-%s", strings.Map(func(r rune) rune {
+	return fmt.Sprintf("%s-%d-%s", g.escape(id), p.PrivatePort, p.Type)
+}
+
+func (g *gorb) escape(id string) string {
+	return strings.Map(func(r rune) rune {
 		switch r {
 		case '/', ':':
 			return '-'
 		default:
 			return r
 		}
-	}, id), p.PrivatePort, p.Type)
+	}, id)
 }
 
 type errorDispatch map[int]func() error
 
 func (g *gorb) roundtrip(req *http.Request, ed errorDispatch) error {
+	return g.exchange(req, nil, ed)
+}
+
+// exchange performs a request, decoding the response body into v if set.
+func (g *gorb) exchange(
+	req *http.Request, v interface{}, ed errorDispatch) error {
+
 	client := http.Client{}
 	r, err := client.Do(req)
 
@@ -219,7 +416,11 @@ func (g *gorb) roundtrip(req *http.Request, ed errorDispatch) error {
 	}
 
 	if r.StatusCode == http.StatusOK {
-		return nil
+		if v == nil {
+			return nil
+		}
+
+		return json.NewDecoder(r.Body).Decode(v)
 	} else if h, exists := ed[r.StatusCode]; exists {
 		return h()
 	}
@@ -0,0 +1,131 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+)
+
+// vendoredGorbMethods extracts the forwarding methods the vendored Gorb
+// accepts from the switch in BackendOptions.Validate.
+func vendoredGorbMethods(t *testing.T) map[string]bool {
+	f, err := parser.ParseFile(token.NewFileSet(),
+		"../vendor/github.com/kobolog/gorb/core/options.go", nil, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := make(map[string]bool)
+
+	for _, d := range f.Decls {
+		fn, ok := d.(*ast.FuncDecl)
+
+		if !ok || fn.Name.Name != "Validate" || fn.Recv == nil {
+			continue
+		}
+
+		if star, ok := fn.Recv.List[0].Type.(*ast.StarExpr); !ok ||
+			star.X.(*ast.Ident).Name != "BackendOptions" {
+			continue
+		}
+
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			s, ok := n.(*ast.SwitchStmt)
+
+			if !ok {
+				return true
+			}
+
+			if tag, ok := s.Tag.(*ast.SelectorExpr); !ok || tag.Sel.Name != "Method" {
+				return true
+			}
+
+			for _, stmt := range s.Body.List {
+				for _, e := range stmt.(*ast.CaseClause).List {
+					if lit, ok := e.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+						m, _ := strconv.Unquote(lit.Value)
+						r[m] = true
+					}
+				}
+			}
+
+			return false
+		})
+	}
+
+	if len(r) == 0 {
+		t.Fatal("no forwarding methods found in the vendored gorb")
+	}
+
+	return r
+}
+
+func TestGorbMethods(t *testing.T) {
+	accepted := vendoredGorbMethods(t)
+
+	if !accepted[defaultDirectMethod] {
+		t.Errorf("default method %q is not accepted by gorb, only %v",
+			defaultDirectMethod, accepted)
+	}
+
+	for m := range gorbMethods {
+		if !accepted[m] {
+			t.Errorf("method %q is not accepted by gorb", m)
+		}
+	}
+
+	for m := range accepted {
+		if !gorbMethods[m] {
+			t.Errorf("method %q is accepted by gorb, but not by tesson", m)
+		}
+	}
+}
+
+func TestNewGorbFrontendMethod(t *testing.T) {
+	for _, c := range []struct {
+		uri    string
+		method string
+		fail   bool
+	}{
+		{uri: "lo://127.0.0.1:4672", method: defaultDirectMethod},
+		{uri: "lo://127.0.0.1:4672?method=NAT", method: "nat"},
+		{uri: "lo://127.0.0.1:4672?method=dr", fail: true},
+	} {
+		f, err := NewGorbFrontend(c.uri, Namespace{})
+
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s: expected an error", c.uri)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", c.uri, err)
+		} else if m := f.(*gorb).method; m != c.method {
+			t.Errorf("%s: got %s, want %s", c.uri, m, c.method)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/engine-api/client"
+	"github.com/docker/engine-api/types"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// A list of supported image pull policies.
+const (
+	PullMissing = "missing" // Pull if the image is not present locally.
+	PullAlways  = "always"  // Always pull to pick up moved tags.
+	PullNever   = "never"   // Only use local images.
+)
+
+const defaultRegistry = "https://index.docker.io/v1/"
+
+var (
+	errBadRegistryAuth = errors.New("registry auth must be 'username:password'")
+)
+
+// Resolver is implemented by runtimes which pin groups to the exact image
+// build their tag pointed to at Exec time.
+type Resolver interface {
+	Resolve(opts ExecOptions) (string, error)
+}
+
+// Implementation
+
+// Resolve returns the reference shards would be spawned from now, pulling
+// the image according to the pull policy.
+func (d *docker) Resolve(opts ExecOptions) (string, error) {
+	return d.resolve(opts.Image, opts)
+}
+
+// resolve makes sure the image is available locally according to the pull
+// policy, and returns a reference pinned to the exact image build: either a
+// repository digest, or an image ID for images which were never pushed.
+func (d *docker) resolve(image string, opts ExecOptions) (string, error) {
+	ref, err := reference.ParseNamed(image)
+
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := ref.(reference.Digested); ok {
+		return image, d.fetch(ref, opts, false)
+	}
+
+	if err := d.fetch(ref, opts, true); err != nil {
+		return "", err
+	}
+
+	i, _, err := d.client.ImageInspectWithRaw(d.ctx, image, false)
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, digest := range i.RepoDigests {
+		if strings.HasPrefix(digest, ref.Name()+"@") {
+			return digest, nil
+		}
+	}
+
+	return i.ID, nil
+}
+
+// fetch pulls the image according to the pull policy. Digested references
+// are immutable, so there's no point pulling them if they're local already.
+func (d *docker) fetch(ref reference.Named, opts ExecOptions, mutable bool) error {
+	switch opts.Pull {
+	case PullNever:
+		return nil
+	case PullAlways:
+		if mutable {
+			break
+		}
+
+		fallthrough
+	case PullMissing, "":
+		_, _, err := d.client.ImageInspectWithRaw(d.ctx, ref.String(), false)
+
+		if err == nil {
+			return nil
+		} else if !client.IsErrImageNotFound(err) {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown pull policy '%s'", opts.Pull)
+	}
+
+	auth, err := credentials(ref, opts.Auth)
+
+	if err != nil {
+		return err
+	}
+
+	log.Infof("pulling image: %s.", ref)
+
+	r, err := d.client.ImagePull(d.ctx, ref.String(), types.ImagePullOptions{
+		RegistryAuth: auth,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	return progress(r)
+}
+
+type pullMessage struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Progress string `json:"progress"`
+	Error    string `json:"error"`
+}
+
+// progress reports image pull progress.
+func progress(r io.Reader) error {
+	var (
+		dec    = json.NewDecoder(r)
+		status = make(map[string]string)
+	)
+
+	for {
+		var m pullMessage
+
+		if err := dec.Decode(&m); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if len(m.Error) != 0 {
+			return fmt.Errorf("pull error: %s", m.Error)
+		}
+
+		// Only status changes are reported, progress bars are too noisy.
+		if status[m.ID] == m.Status {
+			log.Debugf("pull: %s %s %s", m.ID, m.Status, m.Progress)
+			continue
+		}
+
+		status[m.ID] = m.Status
+
+		if len(m.ID) != 0 {
+			log.Infof("pull: %s: %s.", m.ID, m.Status)
+		} else {
+			log.Infof("pull: %s.", m.Status)
+		}
+	}
+}
+
+// credentials builds the registry auth header. Explicit credentials must be
+// in the "username:password" format, otherwise they're looked up in Docker
+// config file.
+func credentials(ref reference.Named, auth string) (string, error) {
+	registry, _ := reference.SplitHostname(ref)
+
+	if len(registry) == 0 || registry == "docker.io" {
+		registry = defaultRegistry
+	}
+
+	var c types.AuthConfig
+
+	if len(auth) != 0 {
+		p := strings.SplitN(auth, ":", 2)
+
+		if len(p) != 2 {
+			return "", errBadRegistryAuth
+		}
+
+		c = types.AuthConfig{Username: p[0], Password: p[1]}
+	} else if a, ok := dockerConfigAuth(registry); ok {
+		c = a
+	} else {
+		return "", nil
+	}
+
+	c.ServerAddress = registry
+
+	b, err := json.Marshal(c)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+// dockerConfigAuth looks up registry credentials in Docker config file.
+func dockerConfigAuth(registry string) (types.AuthConfig, bool) {
+	dir := os.Getenv("DOCKER_CONFIG")
+
+	if len(dir) == 0 {
+		dir = filepath.Join(os.Getenv("HOME"), ".docker")
+	}
+
+	f, err := os.Open(filepath.Join(dir, "config.json"))
+
+	if err != nil {
+		return types.AuthConfig{}, false
+	}
+
+	defer f.Close()
+
+	var cfg struct {
+		Auths map[string]types.AuthConfig `json:"auths"`
+	}
+
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		log.Warnf("unable to parse docker config: %v.", err)
+		return types.AuthConfig{}, false
+	}
+
+	for k, v := range cfg.Auths {
+		if k != registry && strings.TrimPrefix(
+			strings.TrimPrefix(k, "https://"), "http://") != registry {
+			continue
+		}
+
+		b, err := base64.StdEncoding.DecodeString(v.Auth)
+
+		if err != nil {
+			return types.AuthConfig{}, false
+		}
+
+		p := strings.SplitN(string(b), ":", 2)
+
+		if len(p) != 2 {
+			return types.AuthConfig{}, false
+		}
+
+		return types.AuthConfig{Username: p[0], Password: p[1]}, true
+	}
+
+	return types.AuthConfig{}, false
+}
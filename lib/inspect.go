@@ -0,0 +1,66 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import "time"
+
+// Inspector is implemented by runtimes which can report detailed shard state.
+type Inspector interface {
+	Inspect(group string) (Group, error)
+}
+
+// Implementation
+
+func (d *docker) Inspect(group string) (Group, error) {
+	g, err := d.Info(group)
+
+	if err != nil {
+		return Group{}, err
+	}
+
+	for i, shard := range g.Shards {
+		j, err := d.client.ContainerInspect(d.ctx, shard.ID)
+
+		if err != nil {
+			return Group{}, err
+		}
+
+		s := &g.Shards[i]
+
+		if t, err := time.Parse(time.RFC3339Nano, j.Created); err == nil {
+			s.Created = t
+		}
+
+		s.Restarts = j.RestartCount
+
+		if j.State != nil {
+			s.ExitCode = j.State.ExitCode
+
+			if j.State.Health != nil {
+				s.Health = j.State.Health.Status
+			}
+		}
+
+		if j.HostConfig != nil {
+			s.Mems = j.HostConfig.CpusetMems
+		}
+	}
+
+	return g, nil
+}
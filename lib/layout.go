@@ -18,6 +18,7 @@
 
 package tesson
 
+// #include <stdlib.h>
 // #include <hwloc.h>
 // #cgo CFLAGS: -Wno-deprecated-declarations
 // #cgo LDFLAGS: -lhwloc
@@ -27,6 +28,9 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"unsafe"
+
+	log "github.com/Sirupsen/logrus"
 )
 
 var (
@@ -43,6 +47,21 @@ type Topology interface {
 type Unit interface {
 	String() string
 	Weight() int
+	Node() int     // NUMA node, or -1 if the unit spans several nodes.
+	Memory() int64 // Memory local to the unit's NUMA nodes, in bytes.
+	Socket() int   // Processor socket, or -1 if the unit spans several sockets.
+}
+
+// Binder is implemented by topologies which can bind the calling thread to
+// a unit. Processes spawned by the thread inherit the binding.
+type Binder interface {
+	Bind(u Unit) error
+}
+
+// Locator is implemented by topologies which can map a cpuset, e.g. one
+// assigned to a container by hand, back to a unit.
+type Locator interface {
+	Locate(cpuset string) (Unit, error)
 }
 
 // DistributeOptions specifies options for Distribute.
@@ -104,7 +123,10 @@ func (t *hwloc) N() int {
 }
 
 type unit struct {
-	c C.hwloc_cpuset_t
+	c      C.hwloc_cpuset_t
+	node   int
+	memory int64
+	socket int
 }
 
 func (u unit) String() string {
@@ -118,6 +140,18 @@ func (u unit) Weight() int {
 	return int(C.hwloc_bitmap_weight((C.hwloc_const_bitmap_t)(u.c)))
 }
 
+func (u unit) Node() int {
+	return u.node
+}
+
+func (u unit) Memory() int64 {
+	return u.memory
+}
+
+func (u unit) Socket() int {
+	return u.socket
+}
+
 func (t *hwloc) Distribute(
 	n int, opts DistributeOptions) ([]Unit, error) {
 
@@ -134,12 +168,128 @@ func (t *hwloc) Distribute(
 	r := make([]Unit, n)
 
 	for i, c := range l {
-		r[i] = &unit{c: c}
+		r[i] = &unit{c: c, node: t.node(c), memory: t.memory(c),
+			socket: t.socket(c)}
 	}
 
 	return r, nil
 }
 
+func (t *hwloc) node(c C.hwloc_cpuset_t) int {
+	n := C.hwloc_bitmap_alloc()
+	defer C.hwloc_bitmap_free(n)
+
+	C.hwloc_cpuset_to_nodeset(t.ptr, (C.hwloc_const_bitmap_t)(c), n)
+
+	switch C.hwloc_bitmap_weight((C.hwloc_const_bitmap_t)(n)) {
+	case 0:
+		return 0 // Machines with no NUMA have a single implicit node.
+	case 1:
+		return int(C.hwloc_bitmap_first((C.hwloc_const_bitmap_t)(n)))
+	}
+
+	return -1
+}
+
+func (t *hwloc) memory(c C.hwloc_cpuset_t) int64 {
+	var (
+		r   int64
+		obj C.hwloc_obj_t
+	)
+
+	for {
+		obj = C.hwloc_get_next_obj_covering_cpuset_by_type(
+			t.ptr, (C.hwloc_const_bitmap_t)(c), C.HWLOC_OBJ_NODE, obj)
+
+		if obj == nil {
+			break
+		}
+
+		r += int64(obj.memory.local_memory)
+	}
+
+	if r == 0 {
+		// Machines with no NUMA have all memory attached to the root.
+		r = int64(C.hwloc_get_root_obj(t.ptr).memory.total_memory)
+	}
+
+	return r
+}
+
+func (t *hwloc) socket(c C.hwloc_cpuset_t) int {
+	var (
+		r   = -1
+		obj C.hwloc_obj_t
+	)
+
+	for {
+		obj = C.hwloc_get_next_obj_covering_cpuset_by_type(
+			t.ptr, (C.hwloc_const_bitmap_t)(c), C.HWLOC_OBJ_SOCKET, obj)
+
+		if obj == nil {
+			break
+		} else if r != -1 {
+			return -1
+		}
+
+		r = int(obj.os_index)
+	}
+
+	if r == -1 {
+		return 0 // Single socket machines might not report any.
+	}
+
+	return r
+}
+
+func (t *hwloc) Bind(u Unit) error {
+	c := C.hwloc_bitmap_alloc()
+	defer C.hwloc_bitmap_free(c)
+
+	s := C.CString(u.String())
+	defer C.free(unsafe.Pointer(s))
+
+	if C.hwloc_bitmap_list_sscanf(c, s) != 0 {
+		return fmt.Errorf("error parsing cpuset '%s'", u)
+	}
+
+	if C.hwloc_set_cpubind(
+		t.ptr, (C.hwloc_const_cpuset_t)(c), C.HWLOC_CPUBIND_THREAD) != 0 {
+		return fmt.Errorf("unable to bind to cpuset '%s'", u)
+	}
+
+	// Memory is bound to the unit's nodes, which might not be supported,
+	// e.g. on machines with no NUMA.
+	if C.hwloc_set_membind(t.ptr, (C.hwloc_const_cpuset_t)(c),
+		C.HWLOC_MEMBIND_BIND, C.HWLOC_MEMBIND_THREAD) != 0 {
+		log.Warnf("unable to bind memory to cpuset '%s'.", u)
+	}
+
+	return nil
+}
+
+func (t *hwloc) Locate(cpuset string) (Unit, error) {
+	c := C.hwloc_bitmap_alloc()
+
+	s := C.CString(cpuset)
+	defer C.free(unsafe.Pointer(s))
+
+	if C.hwloc_bitmap_list_sscanf(c, s) != 0 {
+		C.hwloc_bitmap_free(c)
+		return nil, fmt.Errorf("error parsing cpuset '%s'", cpuset)
+	}
+
+	if C.hwloc_bitmap_iszero((C.hwloc_const_bitmap_t)(c)) != 0 ||
+		C.hwloc_bitmap_isincluded((C.hwloc_const_bitmap_t)(c),
+			(C.hwloc_const_bitmap_t)(C.hwloc_get_root_obj(t.ptr).cpuset)) == 0 {
+		C.hwloc_bitmap_free(c)
+		return nil, fmt.Errorf("cpuset '%s' is not a part of the topology", cpuset)
+	}
+
+	return &unit{c: c, node: t.node(c), memory: t.memory(c),
+		socket: t.socket(c)}, nil
+}
+
 func (g Granularity) build() C.hwloc_obj_type_t {
 	switch g {
 	case NodeGranularity:
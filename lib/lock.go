@@ -0,0 +1,78 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// GroupLock serializes changes to a group made by different Tesson commands,
+// so that e.g. the daemon doesn't heal a group while it's being stopped or
+// scaled one shard at a time.
+type GroupLock struct {
+	f *os.File
+}
+
+// ErrGroupLocked is returned when a group is locked by another command.
+var ErrGroupLocked = errors.New("group is being changed by another command")
+
+// LockGroup takes the lock of a group in the namespace, which is a file in
+// the namespace state dir. The lock is released when the process exits, so
+// it's never left behind. If wait is false and the group is locked already,
+// ErrGroupLocked is returned.
+func (ns Namespace) LockGroup(dir, group string, wait bool) (*GroupLock, error) {
+	dir = ns.dir(dir)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(
+		filepath.Join(dir, sanitize(group)+".lock"), os.O_RDWR|os.O_CREATE, 0644)
+
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_EX
+
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+
+		if err == syscall.EWOULDBLOCK {
+			return nil, ErrGroupLocked
+		}
+
+		return nil, err
+	}
+
+	return &GroupLock{f: f}, nil
+}
+
+// Unlock releases the lock.
+func (l *GroupLock) Unlock() error {
+	return l.f.Close()
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLockGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tesson")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	ns := Namespace{Name: "team"}
+	l, err := ns.LockGroup(dir, "api", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ns.LockGroup(dir, "api", false); err != ErrGroupLocked {
+		t.Errorf("locked twice: got %v, want %v", err, ErrGroupLocked)
+	}
+
+	for _, other := range []struct {
+		ns    Namespace
+		group string
+	}{
+		{ns: ns, group: "web"},
+		{ns: Namespace{}, group: "api"},
+	} {
+		o, err := other.ns.LockGroup(dir, other.group, false)
+
+		if err != nil {
+			t.Errorf("[%s] %s: %v", other.ns.Name, other.group, err)
+			continue
+		}
+
+		o.Unlock()
+	}
+
+	l.Unlock()
+
+	if l, err = ns.LockGroup(dir, "api", false); err != nil {
+		t.Fatalf("unlocked: %v", err)
+	}
+
+	l.Unlock()
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/engine-api/types"
+)
+
+// Tailer is implemented by runtimes which can stream shard logs.
+type Tailer interface {
+	Logs(shard Shard, opts LogsOptions, fn func(LogLine) error) error
+}
+
+// LogsOptions specifies options for Logs.
+type LogsOptions struct {
+	Follow bool   // Keep streaming new lines as they're written.
+	Since  string // Timestamp or relative duration, e.g. "10m".
+}
+
+// LogLine is a single line of shard output.
+type LogLine struct {
+	Stream string    // Either "stdout" or "stderr".
+	Time   time.Time // Time the line was written.
+	Text   string    // Line, without the trailing newline.
+}
+
+// Implementation
+
+func (d *docker) Logs(
+	shard Shard, opts LogsOptions, fn func(LogLine) error) error {
+
+	i, err := d.client.ContainerInspect(d.ctx, shard.ID)
+
+	if err != nil {
+		return err
+	}
+
+	r, err := d.client.ContainerLogs(d.ctx, shard.ID,
+		types.ContainerLogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Since:      opts.Since,
+			Timestamps: true,
+			Follow:     opts.Follow})
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	if i.Config != nil && i.Config.Tty {
+		// No multiplexing for TTYs, everything is stdout.
+		return scan(r, "stdout", fn)
+	}
+
+	return demux(r, fn)
+}
+
+// demux splits a multiplexed log stream into lines.
+func demux(r io.Reader, fn func(LogLine) error) error {
+	bufs := map[string]*bytes.Buffer{
+		"stdout": new(bytes.Buffer),
+		"stderr": new(bytes.Buffer)}
+
+	if err := frames(r, func(stream string, p []byte) error {
+		b := bufs[stream]
+		b.Write(p)
+
+		// Partial lines are kept until the rest of them arrives.
+		for {
+			i := bytes.IndexByte(b.Bytes(), '\n')
+
+			if i == -1 {
+				return nil
+			}
+
+			line := string(b.Next(i + 1))
+
+			if err := fn(parse(stream, line[:i])); err != nil {
+				return err
+			}
+		}
+	}); err != nil {
+		return err
+	}
+
+	for stream, b := range bufs {
+		if b.Len() == 0 {
+			continue
+		}
+
+		if err := fn(parse(stream, b.String())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// frames reads a multiplexed stream. Each frame has an 8 byte header, with
+// the stream type in the first byte and the frame size in the last 4.
+func frames(r io.Reader, fn func(stream string, p []byte) error) error {
+	var (
+		header [8]byte
+		p      []byte
+	)
+
+	for {
+		if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		stream := "stdout"
+
+		if header[0] == 2 {
+			stream = "stderr"
+		}
+
+		n := int(binary.BigEndian.Uint32(header[4:]))
+
+		if cap(p) < n {
+			p = make([]byte, n)
+		}
+
+		if _, err := io.ReadFull(r, p[:n]); err != nil {
+			return err
+		}
+
+		if err := fn(stream, p[:n]); err != nil {
+			return err
+		}
+	}
+}
+
+// scan splits a raw log stream into lines.
+func scan(r io.Reader, stream string, fn func(LogLine) error) error {
+	s := bufio.NewScanner(r)
+
+	for s.Scan() {
+		if err := fn(parse(stream, s.Text())); err != nil {
+			return err
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("log stream: %v", err)
+	}
+
+	return nil
+}
+
+// parse splits off the timestamp Docker prepends to log lines.
+func parse(stream, text string) LogLine {
+	l := LogLine{Stream: stream, Text: strings.TrimSuffix(text, "\r")}
+
+	if i := strings.IndexByte(l.Text, ' '); i != -1 {
+		if t, err := time.Parse(time.RFC3339Nano, l.Text[:i]); err == nil {
+			l.Time, l.Text = t, l.Text[i+1:]
+		}
+	}
+
+	return l
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// frame encodes a frame of a multiplexed stream, 1 for stdout and 2 for
+// stderr.
+func frame(stream byte, s string) []byte {
+	header := []byte{stream, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[4:], uint32(len(s)))
+
+	return append(header, s...)
+}
+
+func TestDemux(t *testing.T) {
+	var (
+		ts  = "2016-01-02T03:04:05.000000006Z"
+		now = time.Date(2016, 1, 2, 3, 4, 5, 6, time.UTC)
+		bad = errors.New("bad line")
+	)
+
+	for _, c := range []struct {
+		name   string
+		frames [][]byte
+		tail   []byte
+		want   []LogLine
+		fail   bool
+	}{
+		{name: "empty"},
+		{name: "lines",
+			frames: [][]byte{frame(1, ts+" one\n"+ts+" two\n")},
+			want: []LogLine{
+				{Stream: "stdout", Time: now, Text: "one"},
+				{Stream: "stdout", Time: now, Text: "two"}}},
+		{name: "split line",
+			frames: [][]byte{frame(2, ts+" par"), frame(1, ts+" out\n"), frame(2, "tial\r\n")},
+			want: []LogLine{
+				{Stream: "stdout", Time: now, Text: "out"},
+				{Stream: "stderr", Time: now, Text: "partial"}}},
+		{name: "no timestamp",
+			frames: [][]byte{frame(1, "plain text\n")},
+			want:   []LogLine{{Stream: "stdout", Text: "plain text"}}},
+		{name: "unterminated",
+			frames: [][]byte{frame(1, ts+" last")},
+			want:   []LogLine{{Stream: "stdout", Time: now, Text: "last"}}},
+		{name: "truncated",
+			frames: [][]byte{frame(1, ts+" one\n")},
+			tail:   frame(1, "two\n")[:10],
+			want:   []LogLine{{Stream: "stdout", Time: now, Text: "one"}},
+			fail:   true},
+		{name: "callback error",
+			frames: [][]byte{frame(1, "one\nbad line\nthree\n")},
+			want: []LogLine{
+				{Stream: "stdout", Text: "one"},
+				{Stream: "stdout", Text: "bad line"}},
+			fail: true},
+	} {
+		var (
+			b bytes.Buffer
+			l []LogLine
+		)
+
+		for _, f := range c.frames {
+			b.Write(f)
+		}
+
+		b.Write(c.tail)
+
+		err := demux(&b, func(line LogLine) error {
+			l = append(l, line)
+
+			if line.Text == "bad line" {
+				return bad
+			}
+
+			return nil
+		})
+
+		if c.fail && err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		} else if !c.fail && err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+
+		if !reflect.DeepEqual(l, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.name, l, c.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Namespace isolates groups of different owners sharing the same host, so
+// that groups with the same name don't clobber each other.
+type Namespace struct {
+	Name string `json:"-"` // Namespace name, empty for the default namespace.
+	CPUs int    // Maximum number of CPUs for all shards, unlimited if zero.
+}
+
+// LoadNamespace returns a namespace along with its settings, which are kept
+// in the state dir rather than given by whoever manages groups in it, so the
+// CPU cap can't be lifted by simply leaving it out. Namespaces which were
+// never configured have no settings.
+func LoadNamespace(dir, name string) (Namespace, error) {
+	ns := Namespace{Name: name}
+
+	if err := ns.validate(); err != nil {
+		return Namespace{}, err
+	}
+
+	if err := load(ns.path(dir), &ns); err != nil && !os.IsNotExist(err) {
+		return Namespace{}, err
+	}
+
+	return ns, nil
+}
+
+// Save records the namespace settings in the state dir.
+func (ns Namespace) Save(dir string) error {
+	if err := ns.validate(); err != nil {
+		return err
+	}
+
+	if ns.CPUs < 0 {
+		return fmt.Errorf("namespace [%s] cpus must not be negative", ns.Name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ns.path(dir)), 0755); err != nil {
+		return err
+	}
+
+	return save(ns.path(dir), ns)
+}
+
+// GroupName returns the default name of a group running an image, which is
+// the image name with dots replaced, since dots separate namespaces, e.g. in
+// "team.api". Groups named after their image as is, e.g. "example.com/api",
+// were started before that and keep their names.
+func GroupName(image string, groups []Group) string {
+	for _, g := range groups {
+		if g.Name == image {
+			return image
+		}
+	}
+
+	return strings.Replace(image, ".", "-", -1)
+}
+
+// CheckGroup checks that a new group name can't be mistaken for a qualified
+// name of a group in another namespace, e.g. "team.api" for "api" in "team".
+// Groups which exist already keep their names, even if they have dots.
+func CheckGroup(group string, groups []Group) error {
+	if !strings.Contains(group, ".") {
+		return nil
+	}
+
+	for _, g := range groups {
+		if g.Name == group {
+			return nil
+		}
+	}
+
+	return errGroupName
+}
+
+var (
+	errNamespaceName = errors.New("namespace names can only contain letters, digits, '_' and '-'")
+	errGroupName     = errors.New("group names can't contain '.', which separates namespaces")
+)
+
+// Implementation
+
+// validate checks that the namespace name can be used as a prefix as is, so
+// that qualified names can't be mistaken for each other.
+func (ns Namespace) validate() error {
+	for i, r := range ns.Name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case i != 0 && (r == '_' || r == '-'):
+		default:
+			return errNamespaceName
+		}
+	}
+
+	return nil
+}
+
+// dir returns the namespace state dir. Namespaces have their own state dirs,
+// same as in the process runtime.
+func (ns Namespace) dir(dir string) string {
+	if len(ns.Name) != 0 {
+		dir = filepath.Join(dir, "@"+ns.Name)
+	}
+
+	return dir
+}
+
+// path returns the namespace settings file.
+func (ns Namespace) path(dir string) string {
+	return filepath.Join(ns.dir(dir), "namespace.json")
+}
+
+// qualify returns a name which is unique across namespaces, e.g. for host
+// resources such as container names, networks and frontend services.
+func (ns Namespace) qualify(name string) string {
+	if len(ns.Name) == 0 {
+		return name
+	}
+
+	return ns.Name + "." + name
+}
+
+// owns reports whether labels belong to a shard of the namespace. Shards in
+// the default namespace have no label at all.
+func (ns Namespace) owns(labels map[string]string) bool {
+	return labels["tesson.namespace"] == ns.Name
+}
+
+// admit checks whether shards of the namespace, i.e. groups, can take n more
+// CPUs. Negative n releases CPUs. Only live shards count, see Shard.Live.
+func (ns Namespace) admit(groups []Group, n int) error {
+	if ns.CPUs == 0 || n <= 0 {
+		return nil
+	}
+
+	used := 0
+
+	for _, g := range groups {
+		for _, shard := range g.Shards {
+			if shard.Live() {
+				used += shard.Unit.Weight()
+			}
+		}
+	}
+
+	if used+n > ns.CPUs {
+		return fmt.Errorf("namespace [%s] would use %d cpus, limit is %d",
+			ns.Name, used+n, ns.CPUs)
+	}
+
+	return nil
+}
+
+// cpus returns the total number of CPUs in a layout.
+func cpus(l []Unit) int {
+	n := 0
+
+	for _, u := range l {
+		n += u.Weight()
+	}
+
+	return n
+}
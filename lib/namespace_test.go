@@ -0,0 +1,94 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"testing"
+)
+
+func TestGroupName(t *testing.T) {
+	legacy := []Group{{Name: "registry.example.com/app"}}
+
+	for _, c := range []struct {
+		image  string
+		groups []Group
+		want   string
+	}{
+		{image: "example/api", want: "example/api"},
+		{image: "registry.example.com/app", want: "registry-example-com/app"},
+		{image: "registry.example.com/app", groups: legacy, want: "registry.example.com/app"},
+		{image: "registry.example.com/web", groups: legacy, want: "registry-example-com/web"},
+	} {
+		if name := GroupName(c.image, c.groups); name != c.want {
+			t.Errorf("%s: got %s, want %s", c.image, name, c.want)
+		}
+	}
+}
+
+func TestCheckGroup(t *testing.T) {
+	legacy := []Group{{Name: "registry.example.com/app"}}
+
+	for _, c := range []struct {
+		group  string
+		groups []Group
+		fail   bool
+	}{
+		{group: "api"},
+		{group: "team.api", fail: true},
+		{group: "registry.example.com/app", fail: true},
+		{group: "registry.example.com/app", groups: legacy},
+	} {
+		err := CheckGroup(c.group, c.groups)
+
+		switch {
+		case c.fail && err == nil:
+			t.Errorf("%s: expected an error", c.group)
+		case !c.fail && err != nil:
+			t.Errorf("%s: %v", c.group, err)
+		}
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	ns := Namespace{Name: "team", CPUs: 4}
+	groups := []Group{{Name: "api", Shards: []Shard{
+		{State: "running", Unit: quotaUnitB},
+		{State: "restarting", Unit: quotaUnitA},
+		{State: "exited", Unit: quotaUnitB},
+		{State: "dead", Unit: quotaUnitB},
+		{State: "created", Unit: quotaUnitB}}}}
+
+	for _, c := range []struct {
+		n    int
+		fail bool
+	}{
+		{n: 1},
+		{n: 2, fail: true},
+		{n: -3},
+	} {
+		err := ns.admit(groups, c.n)
+
+		switch {
+		case c.fail && err == nil:
+			t.Errorf("%d cpus: expected an error", c.n)
+		case !c.fail && err != nil:
+			t.Errorf("%d cpus: %v", c.n, err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"fmt"
+
+	"github.com/docker/engine-api/client"
+	"github.com/docker/engine-api/types"
+	"github.com/docker/engine-api/types/network"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// MacvlanOptions specifies a macvlan network shards are attached to, so that
+// each shard gets its own IP address directly reachable by the frontend.
+// Macvlan isolates the parent interface from shards, so the host must have
+// a macvlan interface of its own on the same parent to reach them, e.g. for
+// IPVS forwarding and readiness probes.
+type MacvlanOptions struct {
+	Parent  string // Host interface, e.g. "eth0".
+	Subnet  string // Subnet of the parent interface, e.g. "10.0.0.0/24".
+	Gateway string // Gateway, optional.
+	IPRange string // Range to allocate shard addresses from, optional.
+}
+
+// Direct routing mode: frontends forward traffic to shard IPs directly.
+const routingDirect = "direct"
+
+// Implementation
+
+// macvlan creates a macvlan network, or makes sure an existing one with the
+// same name is a macvlan network.
+func (d *docker) macvlan(name string, opts MacvlanOptions) error {
+	n, err := d.client.NetworkInspect(d.ctx, name)
+
+	if err == nil {
+		if n.Driver != "macvlan" {
+			return fmt.Errorf(
+				"network [%s] exists, but it's not a macvlan network", name)
+		}
+
+		return nil
+	} else if !client.IsErrNetworkNotFound(err) {
+		return err
+	}
+
+	var ipam network.IPAM
+
+	if len(opts.Subnet) != 0 {
+		ipam.Config = []network.IPAMConfig{{
+			Subnet:  opts.Subnet,
+			Gateway: opts.Gateway,
+			IPRange: opts.IPRange}}
+	}
+
+	r, err := d.client.NetworkCreate(d.ctx, name, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "macvlan",
+		Options:        map[string]string{"parent": opts.Parent},
+		IPAM:           ipam,
+		Labels:         map[string]string{"tesson.network": "macvlan"}})
+
+	if err != nil {
+		return err
+	}
+
+	log.Infof("network created: %s.", r.ID)
+
+	return nil
+}
+
+// address returns the container IP address on the network it's attached to.
+func address(c types.Container) string {
+	if c.NetworkSettings == nil {
+		return ""
+	}
+
+	if n, ok := c.NetworkSettings.Networks[c.HostConfig.NetworkMode]; ok {
+		return n.IPAddress
+	}
+
+	return ""
+}
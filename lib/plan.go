@@ -0,0 +1,167 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Placement binds a shard ordinal to a unit of allocation.
+type Placement struct {
+	Ordinal int  // Shard ordinal, exported as TESSON_UID.
+	Unit    Unit // Hardware layout.
+}
+
+// Plan describes the changes required to bring a group to a new layout.
+type Plan struct {
+	Keep   []Shard     // Shards which are left intact.
+	Remove []Shard     // Shards to withdraw and stop.
+	Create []Placement // Shards to spawn.
+
+	// Config to spawn shards with, replacing the recorded group config, e.g.
+	// to update a group shard by shard. The layout is taken from the plan.
+	Options *ExecOptions
+}
+
+// PlanLayout matches existing shards against a new layout. Shards pinned
+// to a unit which is still present in the layout are kept, the rest are
+// removed and replaced. Ordinals are kept stable for retained shards and
+// dense across the whole group, i.e. they always span [0, len(layout)).
+func PlanLayout(shards []Shard, layout []Unit) Plan {
+	var (
+		p     Plan
+		n     = len(layout)
+		free  = make(map[string][]int) // Unclaimed layout slots by cpuset.
+		taken = make([]bool, n)        // Claimed ordinals.
+		slots = make([]bool, n)        // Claimed layout slots.
+	)
+
+	for i, u := range layout {
+		free[u.String()] = append(free[u.String()], i)
+	}
+
+	l := make([]Shard, len(shards))
+	copy(l, shards)
+
+	sort.Sort(byOrdinal(l))
+
+	for _, s := range l {
+		if s.Ordinal < 0 || s.Ordinal >= n || taken[s.Ordinal] || s.Unit == nil {
+			p.Remove = append(p.Remove, s)
+			continue
+		}
+
+		k := s.Unit.String()
+
+		if len(free[k]) == 0 {
+			p.Remove = append(p.Remove, s)
+			continue
+		}
+
+		slots[free[k][0]], free[k] = true, free[k][1:]
+		taken[s.Ordinal] = true
+
+		p.Keep = append(p.Keep, s)
+	}
+
+	ordinal := 0
+
+	for i, u := range layout {
+		if slots[i] {
+			continue
+		}
+
+		for taken[ordinal] {
+			ordinal++
+		}
+
+		taken[ordinal] = true
+
+		p.Create = append(p.Create, Placement{Ordinal: ordinal, Unit: u})
+	}
+
+	return p
+}
+
+// PlanRecovery returns a Plan which replaces dead shards on their original
+// units and recreates missing ones. Missing shards are those with ordinals
+// not present in the group, they are placed according to the layout, which
+// must be computed for the whole group.
+func PlanRecovery(shards []Shard, layout []Unit) (Plan, error) {
+	var (
+		p     Plan
+		known = make(map[int]bool)
+	)
+
+	for _, s := range shards {
+		if s.Ordinal >= 0 {
+			known[s.Ordinal] = true
+		}
+
+		if !s.Dead() {
+			p.Keep = append(p.Keep, s)
+			continue
+		}
+
+		if s.Ordinal < 0 || s.Unit == nil {
+			return Plan{}, fmt.Errorf(
+				"shard [%.8s] has no ordinal, use scale to rebalance", s.ID)
+		}
+
+		p.Remove = append(p.Remove, s)
+		p.Create = append(p.Create, Placement{Ordinal: s.Ordinal, Unit: s.Unit})
+	}
+
+	missing := 0
+
+	for i := range layout {
+		if !known[i] {
+			missing++
+		}
+	}
+
+	if missing == 0 {
+		return p, nil
+	}
+
+	// Dead shards will be respawned in place, so they hold their units.
+	q := PlanLayout(shards, layout)
+
+	if len(q.Remove) != 0 {
+		return Plan{}, fmt.Errorf(
+			"layout doesn't match %d shards, use scale to rebalance", len(layout))
+	}
+
+	p.Create = append(p.Create, q.Create...)
+
+	return p, nil
+}
+
+type byOrdinal []Shard
+
+func (l byOrdinal) Len() int { return len(l) }
+func (l byOrdinal) Less(i, j int) bool {
+	if l[i].Ordinal != l[j].Ordinal {
+		return l[i].Ordinal < l[j].Ordinal
+	}
+
+	return l[i].ID < l[j].ID
+}
+func (l byOrdinal) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
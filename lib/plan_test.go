@@ -0,0 +1,150 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var (
+	unitA = unitInfo{CPUSet: "0", NumCPU: 1}
+	unitB = unitInfo{CPUSet: "1", NumCPU: 1}
+	unitC = unitInfo{CPUSet: "2", NumCPU: 1}
+	unitX = unitInfo{CPUSet: "7", NumCPU: 1}
+)
+
+func testShard(id string, ordinal int, u Unit, state string) Shard {
+	return Shard{ID: id, Ordinal: ordinal, Unit: u, State: state}
+}
+
+// summary describes a plan as shard IDs and "ordinal@cpuset" placements.
+func summary(p Plan) [3][]string {
+	var r [3][]string
+
+	for _, s := range p.Keep {
+		r[0] = append(r[0], s.ID)
+	}
+
+	for _, s := range p.Remove {
+		r[1] = append(r[1], s.ID)
+	}
+
+	for _, c := range p.Create {
+		r[2] = append(r[2], fmt.Sprintf("%d@%s", c.Ordinal, c.Unit))
+	}
+
+	return r
+}
+
+func TestPlanLayout(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		shards []Shard
+		layout []Unit
+		want   [3][]string
+	}{
+		{name: "unchanged",
+			shards: []Shard{testShard("a", 0, unitA, "running"), testShard("b", 1, unitB, "running")},
+			layout: []Unit{unitA, unitB},
+			want:   [3][]string{{"a", "b"}, nil, nil}},
+		{name: "empty",
+			layout: []Unit{unitA, unitB},
+			want:   [3][]string{nil, nil, {"0@0", "1@1"}}},
+		{name: "grow",
+			shards: []Shard{testShard("a", 0, unitA, "running"), testShard("b", 1, unitB, "running")},
+			layout: []Unit{unitA, unitB, unitC},
+			want:   [3][]string{{"a", "b"}, nil, {"2@2"}}},
+		{name: "shrink",
+			shards: []Shard{
+				testShard("a", 0, unitA, "running"),
+				testShard("b", 1, unitB, "running"),
+				testShard("c", 2, unitC, "running")},
+			layout: []Unit{unitA, unitB},
+			want:   [3][]string{{"a", "b"}, {"c"}, nil}},
+		{name: "moved",
+			shards: []Shard{testShard("a", 0, unitA, "running"), testShard("x", 1, unitX, "running")},
+			layout: []Unit{unitA, unitB},
+			want:   [3][]string{{"a"}, {"x"}, {"1@1"}}},
+		{name: "duplicate ordinal",
+			shards: []Shard{testShard("b", 0, unitB, "running"), testShard("a", 0, unitA, "running")},
+			layout: []Unit{unitA, unitB},
+			want:   [3][]string{{"a"}, {"b"}, {"1@1"}}},
+		{name: "unknown ordinal",
+			shards: []Shard{testShard("a", -1, unitA, "running")},
+			layout: []Unit{unitA},
+			want:   [3][]string{nil, {"a"}, {"0@0"}}},
+		{name: "ordinal out of range",
+			shards: []Shard{testShard("a", 0, unitA, "running"), testShard("b", 5, unitB, "running")},
+			layout: []Unit{unitA, unitB},
+			want:   [3][]string{{"a"}, {"b"}, {"1@1"}}},
+	} {
+		if p := summary(PlanLayout(c.shards, c.layout)); !reflect.DeepEqual(p, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, p, c.want)
+		}
+	}
+}
+
+func TestPlanRecovery(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		shards []Shard
+		layout []Unit
+		want   [3][]string
+		fail   bool
+	}{
+		{name: "healthy",
+			shards: []Shard{testShard("a", 0, unitA, "running"), testShard("b", 1, unitB, "running")},
+			layout: []Unit{unitA, unitB},
+			want:   [3][]string{{"a", "b"}, nil, nil}},
+		{name: "dead in place",
+			shards: []Shard{testShard("a", 0, unitA, "running"), testShard("b", 1, unitX, "exited")},
+			layout: []Unit{unitA, unitB},
+			want:   [3][]string{{"a"}, {"b"}, {"1@7"}}},
+		{name: "missing",
+			shards: []Shard{testShard("a", 0, unitA, "running"), testShard("c", 2, unitC, "dead")},
+			layout: []Unit{unitA, unitB, unitC},
+			want:   [3][]string{{"a"}, {"c"}, {"2@2", "1@1"}}},
+		{name: "dead without ordinal",
+			shards: []Shard{testShard("a", -1, unitA, "exited")},
+			layout: []Unit{unitA},
+			fail:   true},
+		{name: "layout mismatch",
+			shards: []Shard{testShard("x", 0, unitX, "running")},
+			layout: []Unit{unitA, unitB},
+			fail:   true},
+	} {
+		p, err := PlanRecovery(c.shards, c.layout)
+
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", c.name, summary(p))
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		} else if s := summary(p); !reflect.DeepEqual(s, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, s, c.want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/docker/engine-api/types"
+	"github.com/docker/go-connections/nat"
+)
+
+// parsePortSpec parses Docker port specs, extended with per-shard host port
+// allocation. A host port range with a single container port is split among
+// shards, e.g. "9000-9099:8080" publishes port 8080 of shard N as 9000 + N.
+// A host port followed by "+" is a shorthand for an open-ended range, e.g.
+// "8080+" which publishes port 8080 of shard N as 8080 + N.
+func parsePortSpec(spec string) ([]nat.PortMapping, error) {
+	var proto string
+
+	if i := strings.LastIndex(spec, "/"); i != -1 {
+		spec, proto = spec[:i], spec[i:]
+	}
+
+	p := strings.Split(spec, ":")
+
+	for i, field := range p {
+		if !strings.HasSuffix(field, "+") {
+			continue
+		}
+
+		base := strings.TrimSuffix(field, "+")
+
+		if i == len(p)-1 {
+			p = append(p, base) // Container port defaults to the base.
+		}
+
+		p[i] = base + "-65535"
+
+		break
+	}
+
+	l, err := nat.ParsePortSpec(strings.Join(p, ":") + proto)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, m := range l {
+		if !strings.Contains(m.Binding.HostPort, "-") {
+			continue
+		}
+
+		lo, hi, err := nat.ParsePortRangeToInt(m.Binding.HostPort)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Rendered for each shard along with the rest of the config.
+		l[i].Binding.HostPort = fmt.Sprintf("{{port %d %d .Ordinal}}", lo, hi)
+	}
+
+	return l, nil
+}
+
+// allocate picks a host port from a range for a shard.
+func allocate(lo, hi, ordinal int) (int, error) {
+	if lo+ordinal > hi {
+		return 0, fmt.Errorf(
+			"host port range %d-%d is too small for shard %d", lo, hi, ordinal)
+	}
+
+	return lo + ordinal, nil
+}
+
+// published returns host ports a shard config publishes.
+func published(hc nat.PortMap) []types.Port {
+	var r []types.Port
+
+	for port, bindings := range hc {
+		for _, b := range bindings {
+			n, err := strconv.Atoi(b.HostPort)
+
+			if err != nil || n == 0 {
+				continue // Ephemeral.
+			}
+
+			ip := b.HostIP
+
+			if len(ip) == 0 {
+				ip = "0.0.0.0"
+			}
+
+			r = append(r, types.Port{IP: ip, PrivatePort: port.Int(),
+				PublicPort: n, Type: port.Proto()})
+		}
+	}
+
+	return r
+}
+
+// allocated merges host ports recorded for a shard at spawn time with the
+// ports Docker reports. Recorded ports are always listed, e.g. while the
+// shard is restarting, so that it's registered with the frontend with the
+// same ports every time. Ephemeral and unpublished ports are only known to
+// Docker.
+func allocated(recorded, reported []types.Port) []types.Port {
+	r := append([]types.Port{}, recorded...)
+
+	known := make(map[string]struct{})
+
+	for _, p := range recorded {
+		known[fmt.Sprintf("%d/%s", p.PublicPort, p.Type)] = struct{}{}
+	}
+
+	for _, p := range reported {
+		if _, ok := known[fmt.Sprintf("%d/%s", p.PublicPort, p.Type)]; ok {
+			continue
+		}
+
+		r = append(r, p)
+	}
+
+	return r
+}
+
+// reserve makes sure host ports published by shards don't collide with each
+// other, with ports published by other containers, given as owner names by
+// port, and are not in use on the host. Shard ordinals are used for errors.
+func reserve(shards map[int][]types.Port, taken map[string]string) error {
+	owners := make(map[string]int)
+	ordinals := make([]int, 0, len(shards))
+
+	for ordinal := range shards {
+		ordinals = append(ordinals, ordinal)
+	}
+
+	// Shards are checked in order, so conflicts are reported consistently.
+	sort.Ints(ordinals)
+
+	for _, ordinal := range ordinals {
+		for _, p := range shards[ordinal] {
+			k := fmt.Sprintf("%d/%s", p.PublicPort, p.Type)
+
+			if other, ok := owners[k]; ok {
+				return fmt.Errorf(
+					"host port %s is published by shards %d and %d", k, other, ordinal)
+			}
+
+			owners[k] = ordinal
+
+			if name, ok := taken[k]; ok {
+				return fmt.Errorf("host port %s is published by %s", k, name)
+			}
+
+			if err := probe(p); err != nil {
+				return fmt.Errorf("host port %s is not available: %v", k, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// probe checks whether a host port can be bound. Ports which Tesson has no
+// permission to bind, e.g. privileged ports when running as a member of the
+// docker group, are assumed to be free.
+func probe(p types.Port) error {
+	addr := net.JoinHostPort(p.IP, strconv.Itoa(p.PublicPort))
+
+	var (
+		c   io.Closer
+		err error
+	)
+
+	if p.Type == "udp" {
+		c, err = net.ListenPacket("udp", addr)
+	} else {
+		c, err = net.Listen("tcp", addr)
+	}
+
+	if denied(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return c.Close()
+}
+
+// denied reports whether a bind failed for lack of permissions.
+func denied(err error) bool {
+	if e, ok := err.(*net.OpError); ok {
+		err = e.Err
+	}
+
+	if e, ok := err.(*os.SyscallError); ok {
+		err = e.Err
+	}
+
+	return err == syscall.EACCES
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/engine-api/types"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestParsePortSpec(t *testing.T) {
+	for _, c := range []struct {
+		spec string
+		want []nat.PortMapping
+		fail bool
+	}{
+		{spec: "8080", want: []nat.PortMapping{
+			{Port: "8080/tcp"}}},
+		{spec: "9000:8080", want: []nat.PortMapping{
+			{Port: "8080/tcp", Binding: nat.PortBinding{HostPort: "9000"}}}},
+		{spec: "9000-9099:8080", want: []nat.PortMapping{
+			{Port: "8080/tcp", Binding: nat.PortBinding{
+				HostPort: "{{port 9000 9099 .Ordinal}}"}}}},
+		{spec: "8080+", want: []nat.PortMapping{
+			{Port: "8080/tcp", Binding: nat.PortBinding{
+				HostPort: "{{port 8080 65535 .Ordinal}}"}}}},
+		{spec: "8080+:80/udp", want: []nat.PortMapping{
+			{Port: "80/udp", Binding: nat.PortBinding{
+				HostPort: "{{port 8080 65535 .Ordinal}}"}}}},
+		{spec: "127.0.0.1:8080+:80", want: []nat.PortMapping{
+			{Port: "80/tcp", Binding: nat.PortBinding{
+				HostIP: "127.0.0.1", HostPort: "{{port 8080 65535 .Ordinal}}"}}}},
+		{spec: "http", fail: true},
+		{spec: "9000-90:8080", fail: true},
+	} {
+		l, err := parsePortSpec(c.spec)
+
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", c.spec, l)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", c.spec, err)
+		} else if !reflect.DeepEqual(l, c.want) {
+			t.Errorf("%s: got %v, want %v", c.spec, l, c.want)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	for _, c := range []struct {
+		lo, hi, ordinal int
+		want            int
+		fail            bool
+	}{
+		{lo: 9000, hi: 9099, ordinal: 0, want: 9000},
+		{lo: 9000, hi: 9099, ordinal: 99, want: 9099},
+		{lo: 9000, hi: 9099, ordinal: 100, fail: true},
+	} {
+		n, err := allocate(c.lo, c.hi, c.ordinal)
+
+		switch {
+		case c.fail && err == nil:
+			t.Errorf("%d-%d/%d: expected an error, got %d", c.lo, c.hi, c.ordinal, n)
+		case !c.fail && err != nil:
+			t.Errorf("%d-%d/%d: %v", c.lo, c.hi, c.ordinal, err)
+		case n != c.want:
+			t.Errorf("%d-%d/%d: got %d, want %d", c.lo, c.hi, c.ordinal, n, c.want)
+		}
+	}
+}
+
+func TestAllocated(t *testing.T) {
+	recorded := []types.Port{
+		{IP: "0.0.0.0", PrivatePort: 8080, PublicPort: 9000, Type: "tcp"}}
+
+	for _, c := range []struct {
+		name     string
+		reported []types.Port
+		want     []types.Port
+	}{
+		{name: "restarting", want: recorded},
+		{name: "running",
+			reported: []types.Port{
+				{IP: "0.0.0.0", PrivatePort: 8080, PublicPort: 9000, Type: "tcp"}},
+			want: recorded},
+		{name: "ephemeral",
+			reported: []types.Port{
+				{IP: "0.0.0.0", PrivatePort: 8080, PublicPort: 9000, Type: "tcp"},
+				{IP: "0.0.0.0", PrivatePort: 9090, PublicPort: 32768, Type: "tcp"}},
+			want: append(recorded,
+				types.Port{IP: "0.0.0.0", PrivatePort: 9090, PublicPort: 32768, Type: "tcp"})},
+	} {
+		if l := allocated(recorded, c.reported); !reflect.DeepEqual(l, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, l, c.want)
+		}
+	}
+}
+
+func TestReserveConflict(t *testing.T) {
+	shards := make(map[int][]types.Port)
+
+	for ordinal := 0; ordinal < 8; ordinal++ {
+		shards[ordinal] = []types.Port{
+			{IP: "127.0.0.1", PrivatePort: 8080, PublicPort: 0, Type: "tcp"}}
+	}
+
+	want := "host port 0/tcp is published by shards 0 and 1"
+
+	for i := 0; i < 16; i++ {
+		if err := reserve(shards, nil); err == nil || err.Error() != want {
+			t.Fatalf("got %v, want %s", err, want)
+		}
+	}
+}
@@ -0,0 +1,687 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/engine-api/types/container"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DefaultStateDir is where the process runtime keeps its state by default.
+const DefaultStateDir = "/var/lib/tesson"
+
+var (
+	errBindingNotSupported = errors.New("topology doesn't support binding")
+	errPortsNotSupported   = errors.New("process runtime doesn't publish ports")
+	errConfigNotSupported  = errors.New("process runtime doesn't support container configs")
+)
+
+// Implementation
+
+// NewProcessContext constructs a RuntimeContext which runs shards as plain
+// processes, bound to their units and confined in cgroups. Group and shard
+// state is kept in dir, separately for each namespace.
+func NewProcessContext(t Topology, dir string, ns Namespace) (RuntimeContext, error) {
+	if err := ns.validate(); err != nil {
+		return nil, err
+	}
+
+	b, ok := t.(Binder)
+
+	if !ok {
+		return nil, errBindingNotSupported
+	}
+
+	if len(ns.Name) != 0 {
+		// Sanitized group names never start with "@".
+		dir = filepath.Join(dir, "@"+sanitize(ns.Name))
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &process{binder: b, dir: dir, cgroups: cgroupRoot, ns: ns}, nil
+}
+
+type process struct {
+	binder  Binder
+	dir     string
+	cgroups string
+	ns      Namespace
+}
+
+// processGroup is the group config, recorded at Exec time.
+type processGroup struct {
+	Name     string
+	Command  string
+	Args     []string
+	Env      []string
+	Names    string
+	Quotas   Quotas
+	Unit     string `json:",omitempty"`
+	Revision string
+}
+
+// processShard is the shard state.
+type processShard struct {
+	ID       string
+	Name     string
+	Ordinal  int
+	PID      int
+	Unit     unitInfo
+	Cgroup   string // Empty if cgroups are not available.
+	Created  time.Time
+	Revision string
+}
+
+func (p *process) Exec(group string, opts ExecOptions) (Group, error) {
+	if _, err := os.Stat(p.path(group, "group.json")); err == nil {
+		return Group{}, fmt.Errorf("group [%s] already exists", group)
+	}
+
+	if err := CheckGroup(group, nil); err != nil {
+		return Group{}, err
+	}
+
+	if err := supported(opts); err != nil {
+		return Group{}, err
+	}
+
+	if err := opts.Quotas.validate(); err != nil {
+		return Group{}, err
+	}
+
+	if l, err := p.List(); err == nil {
+		if err := p.ns.admit(l, cpus(opts.Layout)); err != nil {
+			return Group{}, err
+		}
+	} else {
+		return Group{}, err
+	}
+
+	if err := os.MkdirAll(p.path(group), 0755); err != nil {
+		return Group{}, err
+	}
+
+	g, err := p.record(group, opts)
+
+	if err != nil {
+		return Group{}, err
+	}
+
+	for i, u := range opts.Layout {
+		if _, err := p.spawn(g, Placement{Ordinal: i, Unit: u}, opts.Layout); err != nil {
+			return Group{}, err
+		}
+	}
+
+	return p.Info(group)
+}
+
+// record builds the group config from options and saves it.
+func (p *process) record(group string, opts ExecOptions) (processGroup, error) {
+	g := processGroup{
+		Name:    group,
+		Command: opts.Image,
+		Args:    opts.Args,
+		Env:     opts.Env,
+		Names:   opts.Names,
+		Quotas:  opts.Quotas,
+		Unit:    opts.Unit}
+
+	if len(g.Names) == 0 {
+		g.Names = DefaultNames
+	}
+
+	var err error
+
+	if g.Revision, err = p.Revision(opts); err != nil {
+		return processGroup{}, err
+	}
+
+	return g, save(p.path(group, "group.json"), g)
+}
+
+func (p *process) Revision(opts ExecOptions) (string, error) {
+	if err := supported(opts); err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(struct {
+		Command string
+		Args    []string
+		Env     []string
+		Quotas  Quotas
+	}{opts.Image, opts.Args, opts.Env, opts.Quotas})
+
+	if err != nil {
+		return "", err
+	}
+
+	return revision(b), nil
+}
+
+func (p *process) List() ([]Group, error) {
+	l, err := ioutil.ReadDir(p.dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var r []Group
+
+	for _, fi := range l {
+		var g processGroup
+
+		if err := load(filepath.Join(p.dir, fi.Name(), "group.json"), &g); err != nil {
+			continue // Not a group.
+		}
+
+		i, err := p.Info(g.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, i)
+	}
+
+	sort.Sort(byName(r))
+
+	return r, nil
+}
+
+func (p *process) Info(group string) (Group, error) {
+	var g processGroup
+
+	if err := load(p.path(group, "group.json"), &g); os.IsNotExist(err) {
+		return Group{}, fmt.Errorf("group [%s] does not exist", group)
+	} else if err != nil {
+		return Group{}, err
+	}
+
+	l, err := p.shards(group)
+
+	if err != nil {
+		return Group{}, err
+	}
+
+	i := Group{Name: group, Image: g.Command, Unit: g.Unit}
+
+	for _, s := range l {
+		i.Shards = append(i.Shards, p.convert(s))
+	}
+
+	sort.Sort(byOrdinal(i.Shards))
+
+	return i, nil
+}
+
+func (p *process) Stop(group string, opts StopOptions) error {
+	l, err := p.shards(group)
+
+	if err != nil {
+		return err
+	}
+
+	for _, s := range l {
+		if err := p.stop(group, s, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.Purge {
+		return os.RemoveAll(p.path(group))
+	}
+
+	return nil
+}
+
+func (p *process) Apply(group string, plan Plan, opts StopOptions) ([]Shard, error) {
+	var g processGroup
+
+	if err := load(p.path(group, "group.json"), &g); err != nil {
+		return nil, err
+	}
+
+	if plan.Options != nil {
+		if err := supported(*plan.Options); err != nil {
+			return nil, err
+		}
+
+		if err := plan.Options.Quotas.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	var released, claimed []Unit
+
+	// Shards which aren't live don't count towards the namespace cap, so
+	// removing them releases nothing.
+	for _, shard := range plan.Remove {
+		if shard.Live() {
+			released = append(released, shard.Unit)
+		}
+	}
+
+	for _, placement := range plan.Create {
+		claimed = append(claimed, placement.Unit)
+	}
+
+	if l, err := p.List(); err == nil {
+		if err := p.ns.admit(l, cpus(claimed)-cpus(released)); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+
+	var layout []Unit
+
+	for _, shard := range plan.Keep {
+		layout = append(layout, shard.Unit)
+	}
+
+	for _, placement := range plan.Create {
+		layout = append(layout, placement.Unit)
+	}
+
+	for _, shard := range plan.Remove {
+		var s processShard
+
+		if err := load(p.path(group, shard.ID+".json"), &s); err != nil {
+			return nil, err
+		}
+
+		if err := p.stop(group, s, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if plan.Options != nil && len(plan.Create) != 0 {
+		var err error
+
+		if g, err = p.record(group, *plan.Options); err != nil {
+			return nil, err
+		}
+	}
+
+	var r []Shard
+
+	for _, placement := range plan.Create {
+		s, err := p.spawn(g, placement, layout)
+
+		if err != nil {
+			return nil, err
+		}
+
+		r = append(r, p.convert(s))
+	}
+
+	return r, nil
+}
+
+// supported rejects container-only options, rather than silently ignoring
+// them.
+func supported(opts ExecOptions) error {
+	if len(opts.Ports) != 0 {
+		return errPortsNotSupported
+	}
+
+	if len(opts.Config) != 0 || len(opts.Inline) != 0 {
+		return errConfigNotSupported
+	}
+
+	for option, set := range map[string]bool{
+		"volumes":    len(opts.Volumes) != 0,
+		"entrypoint": len(opts.Entrypoint) != 0,
+		"network":    len(opts.Network) != 0,
+		"labels":     len(opts.Labels) != 0,
+		"macvlan":    opts.Macvlan != nil,
+	} {
+		if set {
+			return fmt.Errorf("process runtime doesn't support %s", option)
+		}
+	}
+
+	return nil
+}
+
+// spawn starts a shard process, bound to its unit and confined in its own
+// cgroup, and records its state.
+func (p *process) spawn(g processGroup, pl Placement, layout []Unit) (processShard, error) {
+	ctx := ShardContext{
+		Group:   g.Name,
+		Ordinal: pl.Ordinal,
+		Size:    len(layout),
+		CPUSet:  pl.Unit.String(),
+		Node:    pl.Unit.Node(),
+		Weight:  pl.Unit.Weight()}
+
+	// Rendered on a copy, since the group config is shared among shards.
+	args := append([]string{g.Command}, g.Args...)
+	env := append([]string{}, g.Env...)
+	name := g.Names
+
+	if err := render(&args, ctx); err != nil {
+		return processShard{}, fmt.Errorf("command template: %v", err)
+	}
+
+	if err := render(&env, ctx); err != nil {
+		return processShard{}, fmt.Errorf("env template: %v", err)
+	}
+
+	if err := render(&name, ctx); err != nil {
+		return processShard{}, fmt.Errorf("name template: %v", err)
+	}
+
+	var r container.Resources
+
+	if err := g.Quotas.apply(&r, pl.Unit, layout); err != nil {
+		return processShard{}, err
+	}
+
+	id, err := identifier()
+
+	if err != nil {
+		return processShard{}, err
+	}
+
+	s := processShard{
+		ID:      id,
+		Name:    sanitize(name),
+		Ordinal: pl.Ordinal,
+		Unit: unitInfo{
+			CPUSet:   pl.Unit.String(),
+			NumCPU:   pl.Unit.Weight(),
+			NodeID:   pl.Unit.Node(),
+			MemSize:  pl.Unit.Memory(),
+			SocketID: pl.Unit.Socket()},
+		Created:  time.Now(),
+		Revision: g.Revision}
+
+	out, err := os.OpenFile(p.path(g.Name, id+".log"),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+
+	if err != nil {
+		return processShard{}, err
+	}
+
+	defer out.Close()
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(append(os.Environ(), env...),
+		fmt.Sprintf("GOMAXPROCS=%d", pl.Unit.Weight()),
+		fmt.Sprintf("TESSON_UID=%d", pl.Ordinal))
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	// Shards must survive Tesson, e.g. when it's interrupted.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if s.Cgroup, err = p.cgroup(g.Name, s.Ordinal, r); err != nil {
+		return processShard{}, fmt.Errorf("shard %d cgroup: %v", s.Ordinal, err)
+	}
+
+	if err := p.start(cmd, pl.Unit, s.Cgroup); err != nil {
+		if len(s.Cgroup) != 0 {
+			os.Remove(s.Cgroup)
+		}
+
+		return processShard{}, err
+	}
+
+	s.PID = cmd.Process.Pid
+
+	// Reaps the process if it exits while Tesson is still running.
+	go cmd.Wait()
+
+	log.Infof("instance created: %v.", s.ID)
+
+	return s, save(p.path(g.Name, s.ID+".json"), s)
+}
+
+// start starts a process bound to a unit. The binding is set on a dedicated
+// thread which the process inherits it from, so that it's bound from the
+// very start. The thread is thrown away afterwards, by exiting the goroutine
+// without unlocking it.
+//
+// If the process has a cgroup, it's traced and thus stopped at exec, before
+// any of its own code runs, until it's moved into the cgroup. The process is
+// killed if that fails.
+func (p *process) start(cmd *exec.Cmd, u Unit, cgroup string) error {
+	errs := make(chan error, 1)
+
+	if len(cgroup) != 0 {
+		cmd.SysProcAttr.Ptrace = true
+	}
+
+	go func() {
+		runtime.LockOSThread()
+
+		if err := p.binder.Bind(u); err != nil {
+			errs <- err
+			return
+		}
+
+		if err := cmd.Start(); err != nil || len(cgroup) == 0 {
+			errs <- err
+			return
+		}
+
+		if err := enter(cmd.Process.Pid, cgroup); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+
+			errs <- fmt.Errorf("unable to confine process: %v", err)
+			return
+		}
+
+		errs <- nil
+	}()
+
+	return <-errs
+}
+
+func (p *process) stop(group string, s processShard, opts StopOptions) error {
+	if p.alive(s) {
+		if err := p.signal(s, syscall.SIGTERM); err != nil {
+			return err
+		}
+
+		for deadline := time.Now().Add(opts.Timeout); p.alive(s); {
+			if time.Now().After(deadline) {
+				if err := p.signal(s, syscall.SIGKILL); err != nil {
+					return err
+				}
+
+				deadline = time.Now().Add(opts.Timeout)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		log.Infof("instance stopped: %v.", s.ID)
+	}
+
+	if !opts.Purge {
+		return nil
+	}
+
+	if len(s.Cgroup) != 0 {
+		if err := os.Remove(s.Cgroup); err != nil && !os.IsNotExist(err) {
+			log.Warnf("unable to remove cgroup: %v.", err)
+		}
+	}
+
+	for _, name := range []string{s.ID + ".json", s.ID + ".log"} {
+		if err := os.Remove(p.path(group, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// signal sends a signal to the shard process, along with its children if it
+// has a cgroup. Processes which have exited already are not an error.
+func (p *process) signal(s processShard, sig syscall.Signal) error {
+	if len(s.Cgroup) != 0 {
+		if err := kill(s.Cgroup, sig); !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := syscall.Kill(s.PID, sig); err != nil && err != syscall.ESRCH {
+		return err
+	}
+
+	return nil
+}
+
+// shards loads states of all shards of a group.
+func (p *process) shards(group string) ([]processShard, error) {
+	l, err := filepath.Glob(p.path(group, "*.json"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var r []processShard
+
+	for _, path := range l {
+		if filepath.Base(path) == "group.json" {
+			continue
+		}
+
+		var s processShard
+
+		if err := load(path, &s); err != nil {
+			return nil, err
+		}
+
+		r = append(r, s)
+	}
+
+	return r, nil
+}
+
+func (p *process) convert(s processShard) Shard {
+	state, status := "running", fmt.Sprintf("Up since %s", s.Created.Format(time.Stamp))
+
+	if !p.alive(s) {
+		state, status = "exited", "Exited"
+	}
+
+	u := s.Unit
+
+	shard := Shard{
+		Name:     s.Name,
+		ID:       s.ID,
+		Ordinal:  s.Ordinal,
+		State:    state,
+		Revision: s.Revision,
+		Status:   status,
+		Created:  s.Created,
+		Unit:     &u}
+
+	if u.NodeID >= 0 {
+		shard.Mems = strconv.Itoa(u.NodeID)
+	}
+
+	return shard
+}
+
+// alive reports whether the shard process is still running. Processes in a
+// cgroup are looked up there, which is not prone to PID reuse.
+func (p *process) alive(s processShard) bool {
+	if len(s.Cgroup) != 0 {
+		b, err := ioutil.ReadFile(filepath.Join(s.Cgroup, "cgroup.procs"))
+
+		if err == nil {
+			return len(strings.TrimSpace(string(b))) != 0
+		}
+	}
+
+	if s.PID == 0 {
+		return false
+	}
+
+	err := syscall.Kill(s.PID, 0)
+
+	return err == nil || err == syscall.EPERM
+}
+
+func (p *process) path(group string, elem ...string) string {
+	return filepath.Join(append([]string{p.dir, sanitize(group)}, elem...)...)
+}
+
+// identifier generates a random shard ID.
+func identifier() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func save(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	// Written to a temporary file first, so that state is never torn.
+	if err := ioutil.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func load(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/engine-api/types/container"
+	"github.com/docker/go-units"
+)
+
+// Quotas specifies per-shard resource quotas derived from shard units.
+type Quotas struct {
+	Memory            string `json:",omitempty" yaml:"memory"`             // Memory limit: a size, or NodeShare.
+	MemoryPerCore     string `json:",omitempty" yaml:"memory-per-core"`    // Memory limit per CPU of the unit.
+	MemoryReservation string `json:",omitempty" yaml:"memory-reservation"` // Soft limit: a size, or a percentage of the limit.
+	CPUShares         string `json:",omitempty" yaml:"cpu-shares"`         // CPU shares: a number, or Weighted.
+
+	// Group budget, split among shards in proportion to unit weight. Shares
+	// are never rounded up, so that the group can't exceed its budget: if a
+	// shard would get fewer CPUs or processes than it can run with, quotas
+	// are refused. Block IO weights are relative rather than a budget, so
+	// they are clamped to the allowed range instead.
+	GroupMemory   string  `json:",omitempty" yaml:"group-memory"`    // Total memory limit.
+	GroupCPUs     float64 `json:",omitempty" yaml:"group-cpus"`      // Total CPUs, enforced by CFS quotas.
+	GroupPids     int64   `json:",omitempty" yaml:"group-pids"`      // Total number of processes.
+	GroupIOWeight int     `json:",omitempty" yaml:"group-io-weight"` // Total block IO weight.
+
+	CgroupParent string `json:",omitempty" yaml:"cgroup-parent"` // Shared parent cgroup.
+}
+
+// Special quota values.
+const (
+	NodeShare = "node-share" // Split NUMA node memory evenly among its shards.
+	Weighted  = "weighted"   // Proportional to the unit weight.
+)
+
+const (
+	defaultCPUShares = 1024
+	defaultCPUPeriod = 100000 // Microseconds.
+	minCPUQuota      = 1000   // Microseconds, the lowest CFS quota allowed.
+
+	minIOWeight = 10
+	maxIOWeight = 1000
+)
+
+var (
+	errConflictingMemoryQuotas = errors.New(
+		"memory, memory-per-core and group-memory quotas are mutually exclusive")
+	errUnknownNodeMemory = errors.New(
+		"node memory capacity is unknown, unable to compute its share")
+	errReservationWithoutLimit = errors.New(
+		"relative memory reservation requires a memory limit")
+	errNegativeBudget = errors.New("group budget must not be negative")
+)
+
+// Implementation
+
+// empty reports whether no quotas are specified.
+func (q Quotas) empty() bool {
+	return q == Quotas{}
+}
+
+// validate checks quotas without a unit at hand, to fail before spawning.
+func (q Quotas) validate() error {
+	n := 0
+
+	for _, v := range []string{q.Memory, q.MemoryPerCore, q.GroupMemory} {
+		if len(v) != 0 {
+			n++
+		}
+	}
+
+	if n > 1 {
+		return errConflictingMemoryQuotas
+	}
+
+	if q.GroupCPUs < 0 || q.GroupPids < 0 || q.GroupIOWeight < 0 {
+		return errNegativeBudget
+	}
+
+	u := unitInfo{NumCPU: 1, NodeID: 0, MemSize: 1 << 30}
+
+	return q.apply(&container.Resources{}, u, []Unit{u})
+}
+
+// apply computes resources of a shard placed on u, which is a part of the
+// group layout.
+func (q Quotas) apply(r *container.Resources, u Unit, layout []Unit) error {
+	var err error
+
+	switch {
+	case q.Memory == NodeShare:
+		if u.Memory() == 0 {
+			return errUnknownNodeMemory
+		}
+
+		n := 0
+
+		for _, peer := range layout {
+			if peer.Node() == u.Node() {
+				n++
+			}
+		}
+
+		r.Memory = u.Memory() / int64(n)
+	case len(q.Memory) != 0:
+		if r.Memory, err = units.RAMInBytes(q.Memory); err != nil {
+			return fmt.Errorf("memory quota: %v", err)
+		}
+	case len(q.MemoryPerCore) != 0:
+		n, err := units.RAMInBytes(q.MemoryPerCore)
+
+		if err != nil {
+			return fmt.Errorf("memory-per-core quota: %v", err)
+		}
+
+		r.Memory = n * int64(u.Weight())
+	case len(q.GroupMemory) != 0:
+		n, err := units.RAMInBytes(q.GroupMemory)
+
+		if err != nil {
+			return fmt.Errorf("group memory budget: %v", err)
+		}
+
+		r.Memory = int64(float64(n) * share(u, layout))
+	}
+
+	if v := q.MemoryReservation; strings.HasSuffix(v, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+
+		if err != nil || p <= 0 || p > 100 {
+			return fmt.Errorf("memory reservation: bad percentage '%s'", v)
+		}
+
+		if r.Memory == 0 {
+			return errReservationWithoutLimit
+		}
+
+		r.MemoryReservation = int64(float64(r.Memory) * p / 100)
+	} else if len(v) != 0 {
+		if r.MemoryReservation, err = units.RAMInBytes(v); err != nil {
+			return fmt.Errorf("memory reservation: %v", err)
+		}
+	}
+
+	switch v := q.CPUShares; v {
+	case "":
+	case Weighted:
+		r.CPUShares = defaultCPUShares * int64(u.Weight())
+	default:
+		if r.CPUShares, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return fmt.Errorf("cpu shares: bad value '%s'", v)
+		}
+	}
+
+	if q.GroupCPUs > 0 {
+		r.CPUPeriod = defaultCPUPeriod
+		r.CPUQuota = int64(q.GroupCPUs * share(u, layout) * defaultCPUPeriod)
+
+		if r.CPUQuota < minCPUQuota {
+			return fmt.Errorf(
+				"group cpus budget: shard on %s would get %.3f cpus, minimum is %.2f",
+				u, float64(r.CPUQuota)/defaultCPUPeriod,
+				float64(minCPUQuota)/defaultCPUPeriod)
+		}
+	}
+
+	if q.GroupPids > 0 {
+		r.PidsLimit = int64(float64(q.GroupPids) * share(u, layout))
+
+		if r.PidsLimit < 1 {
+			return fmt.Errorf(
+				"group pids budget: shard on %s would get no processes", u)
+		}
+	}
+
+	if q.GroupIOWeight > 0 {
+		w := int(float64(q.GroupIOWeight) * share(u, layout))
+
+		if w < minIOWeight {
+			w = minIOWeight
+		} else if w > maxIOWeight {
+			w = maxIOWeight
+		}
+
+		r.BlkioWeight = uint16(w)
+	}
+
+	if len(q.CgroupParent) != 0 {
+		r.CgroupParent = q.CgroupParent
+	}
+
+	return nil
+}
+
+// share returns the fraction of the group budget a shard placed on u gets.
+func share(u Unit, layout []Unit) float64 {
+	total := 0
+
+	for _, peer := range layout {
+		total += peer.Weight()
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return float64(u.Weight()) / float64(total)
+}
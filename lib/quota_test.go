@@ -0,0 +1,201 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/engine-api/types/container"
+)
+
+var (
+	quotaUnitA = unitInfo{CPUSet: "0", NumCPU: 1, NodeID: 0, MemSize: 8 << 30}
+	quotaUnitB = unitInfo{CPUSet: "1-2", NumCPU: 2, NodeID: 0, MemSize: 8 << 30}
+	quotaUnitC = unitInfo{CPUSet: "8", NumCPU: 1, NodeID: 1, MemSize: 8 << 30}
+
+	quotaLayout = []Unit{quotaUnitA, quotaUnitB, quotaUnitC}
+)
+
+type quotaCase struct {
+	name   string
+	quotas Quotas
+	unit   Unit
+	layout []Unit
+	want   container.Resources
+	fail   bool
+}
+
+func testQuotas(t *testing.T, cases []quotaCase) {
+	for _, q := range cases {
+		var r container.Resources
+
+		err := q.quotas.apply(&r, q.unit, q.layout)
+
+		if q.fail {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %+v", q.name, r)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", q.name, err)
+		} else if !reflect.DeepEqual(r, q.want) {
+			t.Errorf("%s: got %+v, want %+v", q.name, r, q.want)
+		}
+	}
+}
+
+func TestQuotasApply(t *testing.T) {
+	a, b, c, layout := quotaUnitA, quotaUnitB, quotaUnitC, quotaLayout
+
+	testQuotas(t, []quotaCase{
+		{name: "none", quotas: Quotas{}, unit: a, layout: layout},
+		{name: "memory",
+			quotas: Quotas{Memory: "1g"}, unit: a, layout: layout,
+			want: container.Resources{Memory: 1 << 30}},
+		{name: "node share",
+			quotas: Quotas{Memory: NodeShare}, unit: b, layout: layout,
+			want: container.Resources{Memory: 4 << 30}},
+		{name: "node share alone",
+			quotas: Quotas{Memory: NodeShare}, unit: c, layout: layout,
+			want: container.Resources{Memory: 8 << 30}},
+		{name: "node share unknown",
+			quotas: Quotas{Memory: NodeShare}, unit: unitInfo{NumCPU: 1},
+			layout: []Unit{unitInfo{NumCPU: 1}}, fail: true},
+		{name: "memory per core",
+			quotas: Quotas{MemoryPerCore: "512m"}, unit: b, layout: layout,
+			want: container.Resources{Memory: 1 << 30}},
+		{name: "bad memory",
+			quotas: Quotas{Memory: "lots"}, unit: a, layout: layout, fail: true},
+		{name: "relative reservation",
+			quotas: Quotas{Memory: "1g", MemoryReservation: "50%"}, unit: a, layout: layout,
+			want: container.Resources{Memory: 1 << 30, MemoryReservation: 512 << 20}},
+		{name: "absolute reservation",
+			quotas: Quotas{MemoryReservation: "256m"}, unit: a, layout: layout,
+			want: container.Resources{MemoryReservation: 256 << 20}},
+		{name: "reservation without limit",
+			quotas: Quotas{MemoryReservation: "50%"}, unit: a, layout: layout, fail: true},
+		{name: "bad reservation",
+			quotas: Quotas{Memory: "1g", MemoryReservation: "150%"}, unit: a, layout: layout,
+			fail: true},
+		{name: "weighted shares",
+			quotas: Quotas{CPUShares: Weighted}, unit: b, layout: layout,
+			want: container.Resources{CPUShares: 2048}},
+		{name: "fixed shares",
+			quotas: Quotas{CPUShares: "512"}, unit: b, layout: layout,
+			want: container.Resources{CPUShares: 512}},
+		{name: "bad shares",
+			quotas: Quotas{CPUShares: "many"}, unit: b, layout: layout, fail: true},
+	})
+}
+
+func TestQuotasValidate(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		quotas Quotas
+		fail   bool
+	}{
+		{name: "none", quotas: Quotas{}},
+		{name: "memory", quotas: Quotas{Memory: "1g", MemoryReservation: "50%"}},
+		{name: "conflicting memory",
+			quotas: Quotas{Memory: "1g", MemoryPerCore: "512m"}, fail: true},
+		{name: "bad shares", quotas: Quotas{CPUShares: "many"}, fail: true},
+	} {
+		if err := c.quotas.validate(); c.fail && err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		} else if !c.fail && err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+	}
+}
+
+func TestQuotasBudget(t *testing.T) {
+	a, b, layout := quotaUnitA, quotaUnitB, quotaLayout
+
+	testQuotas(t, []quotaCase{
+		{name: "group memory",
+			quotas: Quotas{GroupMemory: "4g"}, unit: b, layout: layout,
+			want: container.Resources{Memory: 2 << 30}},
+		{name: "group cpus",
+			quotas: Quotas{GroupCPUs: 2}, unit: b, layout: layout,
+			want: container.Resources{CPUPeriod: 100000, CPUQuota: 100000}},
+		{name: "group cpus below minimum",
+			quotas: Quotas{GroupCPUs: 0.02}, unit: a, layout: layout, fail: true},
+		{name: "group pids",
+			quotas: Quotas{GroupPids: 100}, unit: b, layout: layout,
+			want: container.Resources{PidsLimit: 50}},
+		{name: "group pids too low",
+			quotas: Quotas{GroupPids: 1}, unit: a, layout: layout,
+			fail: true},
+		{name: "group io weight",
+			quotas: Quotas{GroupIOWeight: 400}, unit: b, layout: layout,
+			want: container.Resources{BlkioWeight: 200}},
+		{name: "group io weight clamped",
+			quotas: Quotas{GroupIOWeight: 20}, unit: a, layout: layout,
+			want: container.Resources{BlkioWeight: 10}},
+		{name: "cgroup parent",
+			quotas: Quotas{CgroupParent: "api.slice"}, unit: a, layout: layout,
+			want: container.Resources{CgroupParent: "api.slice"}},
+	})
+}
+
+func TestQuotasValidateBudget(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		quotas Quotas
+		fail   bool
+	}{
+		{name: "budget", quotas: Quotas{GroupMemory: "4g", GroupCPUs: 2, GroupPids: 100}},
+		{name: "conflicting memory",
+			quotas: Quotas{Memory: "1g", GroupMemory: "4g"}, fail: true},
+		{name: "negative budget", quotas: Quotas{GroupPids: -1}, fail: true},
+	} {
+		if err := c.quotas.validate(); c.fail && err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		} else if !c.fail && err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+	}
+}
+
+func TestShare(t *testing.T) {
+	var (
+		a = unitInfo{CPUSet: "0", NumCPU: 1}
+		b = unitInfo{CPUSet: "1-3", NumCPU: 3}
+	)
+
+	for _, c := range []struct {
+		name   string
+		unit   Unit
+		layout []Unit
+		want   float64
+	}{
+		{name: "alone", unit: b, layout: []Unit{b}, want: 1},
+		{name: "small", unit: a, layout: []Unit{a, b}, want: 0.25},
+		{name: "large", unit: b, layout: []Unit{a, b}, want: 0.75},
+		{name: "empty", unit: a, layout: nil, want: 0},
+	} {
+		if f := share(c.unit, c.layout); f != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, f, c.want)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/engine-api/types"
+)
+
+// Prober is implemented by runtimes which can check shard readiness.
+type Prober interface {
+	Probe(shard Shard, check ReadyCheck) error
+}
+
+// ReadyCheck specifies how shard readiness is checked.
+type ReadyCheck struct {
+	Kind string // One of "health", "tcp" or "http".
+	Port int    // Container port to probe, for "tcp" and "http".
+	Path string // Request path, for "http".
+}
+
+// ParseReadyCheck parses readiness check specs: "health" to rely on image
+// HEALTHCHECK status, "tcp:PORT" to connect to a port, or "http:PORT/PATH"
+// to expect a successful response.
+func ParseReadyCheck(spec string) (ReadyCheck, error) {
+	p := strings.SplitN(spec, ":", 2)
+
+	switch p[0] {
+	case "health":
+		if len(p) == 1 {
+			return ReadyCheck{Kind: p[0]}, nil
+		}
+	case "tcp", "http":
+		if len(p) == 1 {
+			break
+		}
+
+		c := ReadyCheck{Kind: p[0]}
+
+		port := p[1]
+
+		if i := strings.Index(port, "/"); i != -1 {
+			if c.Kind == "tcp" {
+				break
+			}
+
+			port, c.Path = port[:i], port[i:]
+		} else if c.Kind == "http" {
+			c.Path = "/"
+		}
+
+		n, err := strconv.Atoi(port)
+
+		if err != nil || n <= 0 || n > 65535 {
+			break
+		}
+
+		c.Port = n
+
+		return c, nil
+	}
+
+	return ReadyCheck{}, fmt.Errorf("error parsing readiness check '%s'", spec)
+}
+
+// Readiness describes whether a shard has become ready.
+type Readiness struct {
+	Shard  Shard  // Shard.
+	Ready  bool   // Whether the shard is ready.
+	Reason string // Last probe failure, if not ready.
+}
+
+// WaitReady probes shards until all of them are ready or the timeout expires.
+// fn is called for each shard as soon as it becomes ready.
+func WaitReady(p Prober, shards []Shard, check ReadyCheck,
+	timeout time.Duration, fn func(Shard) error) ([]Readiness, error) {
+
+	var (
+		r        = make([]Readiness, len(shards))
+		deadline = time.Now().Add(timeout)
+		pending  = len(shards)
+	)
+
+	for i, shard := range shards {
+		r[i].Shard = shard
+	}
+
+	for {
+		for i := range r {
+			if r[i].Ready {
+				continue
+			}
+
+			if err := p.Probe(r[i].Shard, check); err != nil {
+				r[i].Reason = err.Error()
+				continue
+			}
+
+			r[i].Ready, r[i].Reason = true, ""
+			pending--
+
+			if err := fn(r[i].Shard); err != nil {
+				return r, err
+			}
+		}
+
+		if pending == 0 || time.Now().After(deadline) {
+			return r, nil
+		}
+
+		time.Sleep(probeInterval)
+	}
+}
+
+// Implementation
+
+const (
+	probeInterval = time.Second
+	probeTimeout  = 2 * time.Second
+)
+
+var (
+	errNoHealthcheck = errors.New("image has no healthcheck")
+)
+
+func (d *docker) Probe(shard Shard, check ReadyCheck) error {
+	switch check.Kind {
+	case "health":
+		i, err := d.client.ContainerInspect(d.ctx, shard.ID)
+
+		if err != nil {
+			return err
+		}
+
+		if !i.State.Running {
+			return fmt.Errorf("%s, exit code %d", i.State.Status, i.State.ExitCode)
+		}
+
+		if i.State.Health == nil {
+			return errNoHealthcheck
+		}
+
+		if i.State.Health.Status != types.Healthy {
+			return fmt.Errorf("health status is %s", i.State.Health.Status)
+		}
+
+		return nil
+	case "tcp", "http":
+		return probeEndpoint(shard, check)
+	}
+
+	return fmt.Errorf("unknown readiness check '%s'", check.Kind)
+}
+
+// probeEndpoint checks readiness over the network, given a shard address.
+func probeEndpoint(shard Shard, check ReadyCheck) error {
+	addr, err := endpoint(shard, check.Port)
+
+	if err != nil {
+		return err
+	}
+
+	if check.Kind == "tcp" {
+		c, err := net.DialTimeout("tcp", addr, probeTimeout)
+
+		if err != nil {
+			return err
+		}
+
+		return c.Close()
+	}
+
+	client := http.Client{Timeout: probeTimeout}
+	r, err := client.Get("http://" + addr + check.Path)
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Body.Close()
+
+	if r.StatusCode < 200 || r.StatusCode >= 400 {
+		return fmt.Errorf("http status %d", r.StatusCode)
+	}
+
+	return nil
+}
+
+// endpoint returns the address a container port of a shard is reachable at.
+func endpoint(shard Shard, port int) (string, error) {
+	if len(shard.IP) != 0 {
+		return net.JoinHostPort(shard.IP, strconv.Itoa(port)), nil
+	}
+
+	for _, p := range shard.Ports {
+		if p.PrivatePort != port || p.PublicPort == 0 || p.Type != "tcp" {
+			continue
+		}
+
+		ip := p.IP
+
+		if len(ip) == 0 || ip == "0.0.0.0" {
+			ip = "127.0.0.1"
+		}
+
+		return net.JoinHostPort(ip, strconv.Itoa(p.PublicPort)), nil
+	}
+
+	return "", fmt.Errorf("port %d is not published", port)
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import "testing"
+
+func TestParseReadyCheck(t *testing.T) {
+	for _, c := range []struct {
+		spec string
+		want ReadyCheck
+		fail bool
+	}{
+		{spec: "health", want: ReadyCheck{Kind: "health"}},
+		{spec: "tcp:8080", want: ReadyCheck{Kind: "tcp", Port: 8080}},
+		{spec: "http:8080", want: ReadyCheck{Kind: "http", Port: 8080, Path: "/"}},
+		{spec: "http:8080/healthz?full=1",
+			want: ReadyCheck{Kind: "http", Port: 8080, Path: "/healthz?full=1"}},
+		{spec: "health:8080", fail: true},
+		{spec: "tcp", fail: true},
+		{spec: "tcp:8080/healthz", fail: true},
+		{spec: "http:0", fail: true},
+		{spec: "http:65536/", fail: true},
+		{spec: "http:web/", fail: true},
+		{spec: "udp:53", fail: true},
+		{spec: "", fail: true},
+	} {
+		r, err := ParseReadyCheck(c.spec)
+
+		switch {
+		case c.fail && err == nil:
+			t.Errorf("%q: expected an error, got %+v", c.spec, r)
+		case !c.fail && err != nil:
+			t.Errorf("%q: %v", c.spec, err)
+		case r != c.want:
+			t.Errorf("%q: got %+v, want %+v", c.spec, r, c.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Spec is a declarative sharded container group definition.
+type Spec struct {
+	Name     string       `yaml:"name"`     // Group name, see GroupName if empty.
+	Image    string       `yaml:"image"`    // Container image name.
+	Size     int          `yaml:"size"`     // Number of shards.
+	Unit     string       `yaml:"unit"`     // Binding unit, e.g. "core".
+	Ports    []string     `yaml:"ports"`    // Exposed ports to publish.
+	Names    string       `yaml:"names"`    // Container name pattern.
+	Config   RawConfig    `yaml:"config"`   // Container config.
+	Quotas   Quotas       `yaml:"quotas"`   // Per-shard resource quotas.
+	Ready    string       `yaml:"ready"`    // Readiness check, see ParseReadyCheck.
+	Frontend FrontendSpec `yaml:"frontend"` // Load balancer settings.
+	Compose  ComposeSpec  `yaml:"compose"`  // Compose service to take defaults from.
+}
+
+// FrontendSpec specifies a Frontend for a Spec.
+type FrontendSpec struct {
+	Gorb string `yaml:"gorb"` // Gorb connection URI.
+}
+
+// ComposeSpec refers to a service in a compose file. Its image, ports and
+// config are used unless given in the Spec.
+type ComposeSpec struct {
+	File    string `yaml:"file"`    // Compose file path.
+	Service string `yaml:"service"` // Service name.
+}
+
+// RawConfig is a container config in the Docker API format. It can be given
+// in YAML, and is kept as JSON.
+type RawConfig []byte
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *RawConfig) UnmarshalYAML(fn func(interface{}) error) error {
+	var v interface{}
+
+	if err := fn(&v); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(jsonify(v))
+
+	if err != nil {
+		return err
+	}
+
+	*c = b
+
+	return nil
+}
+
+// ParseSpecs reads group specs in YAML or JSON format. Each document might
+// contain either a single spec or a list of specs.
+func ParseSpecs(r io.Reader) ([]Spec, error) {
+	var (
+		l   []Spec
+		dec = yaml.NewDecoder(r)
+	)
+
+	for {
+		var v interface{}
+
+		if err := dec.Decode(&v); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		n, err := yaml.Marshal(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch v.(type) {
+		case []interface{}:
+			var specs []Spec
+
+			if err := yaml.UnmarshalStrict(n, &specs); err != nil {
+				return nil, err
+			}
+
+			l = append(l, specs...)
+		case map[interface{}]interface{}:
+			var spec Spec
+
+			if err := yaml.UnmarshalStrict(n, &spec); err != nil {
+				return nil, err
+			}
+
+			l = append(l, spec)
+		case nil:
+			// Empty document.
+		default:
+			return nil, fmt.Errorf("unexpected spec document: %v", v)
+		}
+	}
+
+	for i := range l {
+		if err := l[i].inherit(); err != nil {
+			return nil, fmt.Errorf("spec #%d: %v", i, err)
+		}
+
+		if len(l[i].Image) == 0 {
+			return nil, fmt.Errorf("spec #%d has no image", i)
+		}
+
+	}
+
+	return l, nil
+}
+
+// jsonify converts decoded YAML into a structure encoding/json can handle.
+func jsonify(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+
+		for k, item := range v {
+			m[fmt.Sprint(k)] = jsonify(item)
+		}
+
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonify(item)
+		}
+	}
+
+	return v
+}
+
+// inherit fills in the spec from the compose service it refers to, if any.
+func (s *Spec) inherit() error {
+	if len(s.Compose.File) == 0 {
+		return nil
+	}
+
+	base, err := ParseCompose(s.Compose.File, s.Compose.Service)
+
+	if err != nil {
+		return err
+	}
+
+	if len(s.Name) == 0 {
+		s.Name = base.Name
+	}
+
+	if len(s.Image) == 0 {
+		s.Image = base.Image
+	}
+
+	if len(s.Ports) == 0 {
+		s.Ports = base.Ports
+	}
+
+	if len(s.Config) == 0 {
+		s.Config = base.Config
+	}
+
+	return nil
+}
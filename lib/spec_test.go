@@ -0,0 +1,159 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSpecs(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		doc  string
+		want []Spec
+		fail bool
+	}{
+		{name: "single",
+			doc:  "name: api\nimage: example/api\nsize: 4\nports: [\"8080+\"]\n",
+			want: []Spec{{Name: "api", Image: "example/api", Size: 4, Ports: []string{"8080+"}}}},
+		{name: "list",
+			doc: "- {name: api, image: example/api}\n- {name: web, image: example/web}\n",
+			want: []Spec{
+				{Name: "api", Image: "example/api"},
+				{Name: "web", Image: "example/web"}}},
+		{name: "documents",
+			doc: "name: api\nimage: example/api\n---\n---\nname: web\nimage: example/web\n",
+			want: []Spec{
+				{Name: "api", Image: "example/api"},
+				{Name: "web", Image: "example/web"}}},
+		{name: "json",
+			doc:  `{"name": "api", "image": "example/api", "unit": "node"}`,
+			want: []Spec{{Name: "api", Image: "example/api", Unit: "node"}}},
+		{name: "config",
+			doc: "name: api\nimage: example/api\nconfig: {Env: [A=1]}\n",
+			want: []Spec{{Name: "api", Image: "example/api",
+				Config: RawConfig(`{"Env":["A=1"]}`)}}},
+		{name: "quotas",
+			doc: "name: api\nimage: example/api\nquotas: {memory: 1g, group-cpus: 2.5}\n",
+			want: []Spec{{Name: "api", Image: "example/api",
+				Quotas: Quotas{Memory: "1g", GroupCPUs: 2.5}}}},
+		{name: "default name",
+			doc:  "image: example.com/api\n",
+			want: []Spec{{Image: "example.com/api"}}},
+		{name: "unknown field", doc: "name: api\nimage: example/api\nreplicas: 2\n", fail: true},
+		{name: "no image", doc: "name: api\n", fail: true},
+		{name: "scalar", doc: "api\n", fail: true},
+	} {
+		l, err := ParseSpecs(strings.NewReader(c.doc))
+
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %+v", c.name, l)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		} else if !reflect.DeepEqual(l, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.name, l, c.want)
+		}
+	}
+}
+
+func TestSpecInherit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tesson")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "docker-compose.yml")
+
+	if err := ioutil.WriteFile(file, []byte(`
+services:
+  api:
+    image: example/api
+    ports: ["9000-9099:8080"]
+    environment: {A: "1"}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	base := Spec{Compose: ComposeSpec{File: file, Service: "api"}}
+
+	for _, c := range []struct {
+		name string
+		spec Spec
+		want Spec
+		fail bool
+	}{
+		{name: "none",
+			spec: Spec{Name: "web", Image: "example/web"},
+			want: Spec{Name: "web", Image: "example/web"}},
+		{name: "defaults",
+			spec: base,
+			want: Spec{Name: "api", Image: "example/api", Ports: []string{"9000-9099:8080"}}},
+		{name: "overrides",
+			spec: Spec{Name: "edge", Image: "example/api:2", Ports: []string{"80"},
+				Compose: base.Compose},
+			want: Spec{Name: "edge", Image: "example/api:2", Ports: []string{"80"}}},
+		{name: "missing service",
+			spec: Spec{Compose: ComposeSpec{File: file, Service: "web"}},
+			fail: true},
+		{name: "missing file",
+			spec: Spec{Compose: ComposeSpec{File: file + ".orig", Service: "api"}},
+			fail: true},
+	} {
+		s := c.spec
+		err := s.inherit()
+
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %+v", c.name, s)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+
+		// Configs are covered by compose tests.
+		if len(c.spec.Compose.File) != 0 && len(s.Config) == 0 {
+			t.Errorf("%s: config is not inherited", c.name)
+		}
+
+		s.Config, s.Compose = nil, ComposeSpec{}
+
+		if !reflect.DeepEqual(s, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.name, s, c.want)
+		}
+	}
+}
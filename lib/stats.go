@@ -0,0 +1,151 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"encoding/json"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/docker/engine-api/types"
+)
+
+// Monitor is implemented by runtimes which can report shard resource usage.
+type Monitor interface {
+	Stats(shard Shard, stream bool, fn func(Usage) error) error
+}
+
+// Usage is a sample of shard resource usage.
+type Usage struct {
+	Time        time.Time // Time the sample was taken.
+	CPU         float64   // CPU usage, in percent of a single CPU.
+	Throttled   float64   // CFS periods the shard was throttled in, in percent.
+	Memory      uint64    // Memory usage, in bytes.
+	MemoryLimit uint64    // Memory limit, in bytes.
+	NetRx       uint64    // Bytes received.
+	NetTx       uint64    // Bytes sent.
+	BlkRead     uint64    // Bytes read from block devices.
+	BlkWrite    uint64    // Bytes written to block devices.
+}
+
+// Implementation
+
+func (d *docker) Stats(shard Shard, stream bool, fn func(Usage) error) error {
+	r, err := d.client.ContainerStats(d.ctx, shard.ID, stream)
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	dec := json.NewDecoder(r)
+
+	for {
+		var (
+			b json.RawMessage
+			s types.StatsJSON
+			x extraStats
+		)
+
+		if err := dec.Decode(&b); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(b, &x); err != nil {
+			return err
+		}
+
+		if err := fn(usage(s, x)); err != nil {
+			return err
+		}
+	}
+}
+
+// extraStats holds stats fields newer Docker versions report, which the
+// client library doesn't know about.
+type extraStats struct {
+	CPUStats struct {
+		OnlineCPUs uint32 `json:"online_cpus"`
+	} `json:"cpu_stats"`
+}
+
+// usage converts Docker stats, computing rates since the previous sample.
+func usage(s types.StatsJSON, x extraStats) Usage {
+	u := Usage{
+		Time:        s.Read,
+		Memory:      s.MemoryStats.Usage,
+		MemoryLimit: s.MemoryStats.Limit}
+
+	var (
+		cpu = float64(s.CPUStats.CPUUsage.TotalUsage) -
+			float64(s.PreCPUStats.CPUUsage.TotalUsage)
+		system = float64(s.CPUStats.SystemUsage) -
+			float64(s.PreCPUStats.SystemUsage)
+		n = float64(len(s.CPUStats.CPUUsage.PercpuUsage))
+	)
+
+	// System usage covers all host CPUs. Per-CPU usage is not reported on
+	// cgroup v2 hosts, so the number of CPUs is taken from elsewhere.
+	if n == 0 {
+		n = float64(x.CPUStats.OnlineCPUs)
+	}
+
+	if n == 0 {
+		n = float64(runtime.NumCPU())
+	}
+
+	if cpu > 0 && system > 0 {
+		u.CPU = cpu / system * n * 100
+	}
+
+	var (
+		cur = s.CPUStats.ThrottlingData
+		pre = s.PreCPUStats.ThrottlingData
+	)
+
+	if cur.Periods > pre.Periods {
+		u.Throttled = float64(cur.ThrottledPeriods-pre.ThrottledPeriods) /
+			float64(cur.Periods-pre.Periods) * 100
+	}
+
+	for _, n := range s.Networks {
+		u.NetRx += n.RxBytes
+		u.NetTx += n.TxBytes
+	}
+
+	for _, e := range s.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			u.BlkRead += e.Value
+		case "write":
+			u.BlkWrite += e.Value
+		}
+	}
+
+	return u
+}
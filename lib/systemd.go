@@ -0,0 +1,259 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	"github.com/docker/engine-api/types/container"
+	"github.com/docker/go-units"
+)
+
+// File is a generated file, e.g. a systemd unit.
+type File struct {
+	Name    string
+	Content []byte
+}
+
+var (
+	errNoCommand       = errors.New("command is required")
+	errSliceParentName = errors.New("cgroup parent must be a systemd slice, e.g. api.slice")
+)
+
+// Systemd expands specifiers in both command lines and environment
+// assignments, but variables only in command lines.
+var (
+	commandEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$")
+	envEscaper     = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%")
+)
+
+var sliceTemplate = template.Must(template.New("slice").Parse(`# Generated by Tesson.
+[Unit]
+Description=Tesson group {{.Group}}
+
+[Slice]
+{{- range .Limits}}
+{{.}}
+{{- end}}
+`))
+
+var serviceTemplate = template.Must(template.New("service").Parse(`# Generated by Tesson.
+[Unit]
+Description=Tesson group {{.Group}}, shard {{.Ordinal}}
+
+[Service]
+Slice={{.Slice}}
+ExecStart={{.Command}}
+Environment={{.Env}}
+CPUAffinity={{.CPUs}}
+{{- if ge .Node 0}}
+NUMAPolicy=bind
+NUMAMask={{.Node}}
+{{- end}}
+{{- range .Limits}}
+{{.}}
+{{- end}}
+Restart=on-failure
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// Implementation
+
+// ExportSystemd generates systemd units for a group of processes running
+// opts.Image as the command, one service per unit of the layout, enclosed in
+// a slice. Resource quotas are applied to services and to the slice. Units
+// are named after the group qualified with the namespace, so that groups of
+// different namespaces don't clobber each other's units.
+func ExportSystemd(group string, opts ExecOptions, ns Namespace) ([]File, error) {
+	if len(opts.Image) == 0 {
+		return nil, errNoCommand
+	}
+
+	if err := CheckGroup(group, nil); err != nil {
+		return nil, err
+	}
+
+	name := sanitize(ns.qualify(group))
+
+	if err := opts.Quotas.validate(); err != nil {
+		return nil, err
+	}
+
+	// Older systemd versions require an absolute path.
+	command, err := exec.LookPath(opts.Image)
+
+	if err != nil {
+		command = opts.Image
+	}
+
+	var r []File
+
+	slice := opts.Quotas.CgroupParent
+
+	if len(slice) == 0 {
+		// Dashes in slice names mean nesting, so the group name is escaped
+		// to put the slice right under tesson.slice.
+		slice = fmt.Sprintf("tesson-%s.slice",
+			strings.Replace(name, "-", `\x2d`, -1))
+
+		limits, err := budget(opts.Quotas)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var b bytes.Buffer
+
+		if err := sliceTemplate.Execute(&b, struct {
+			Group  string
+			Limits []string
+		}{group, limits}); err != nil {
+			return nil, err
+		}
+
+		r = append(r, File{Name: slice, Content: b.Bytes()})
+	} else if !strings.HasSuffix(slice, ".slice") {
+		return nil, errSliceParentName
+	}
+
+	for i, u := range opts.Layout {
+		ctx := ShardContext{
+			Group:   group,
+			Ordinal: i,
+			Size:    len(opts.Layout),
+			CPUSet:  u.String(),
+			Node:    u.Node(),
+			Weight:  u.Weight()}
+
+		args := append([]string{command}, opts.Args...)
+		env := append([]string{
+			fmt.Sprintf("GOMAXPROCS=%d", u.Weight()),
+			fmt.Sprintf("TESSON_UID=%d", i)}, opts.Env...)
+
+		if err := render(&args, ctx); err != nil {
+			return nil, fmt.Errorf("command template: %v", err)
+		}
+
+		if err := render(&env, ctx); err != nil {
+			return nil, fmt.Errorf("env template: %v", err)
+		}
+
+		var res container.Resources
+
+		if err := opts.Quotas.apply(&res, u, opts.Layout); err != nil {
+			return nil, err
+		}
+
+		var b bytes.Buffer
+
+		if err := serviceTemplate.Execute(&b, struct {
+			ShardContext
+			Slice   string
+			Command string
+			Env     string
+			CPUs    string
+			Limits  []string
+		}{ctx, slice, quote(args, commandEscaper), quote(env, envEscaper), strings.Replace(u.String(), ",", " ", -1),
+			directives(res)}); err != nil {
+			return nil, err
+		}
+
+		r = append(r, File{
+			Name:    fmt.Sprintf("tesson-%s-%d.service", name, i),
+			Content: b.Bytes()})
+	}
+
+	return r, nil
+}
+
+// directives translates shard resources into systemd resource control
+// directives.
+func directives(r container.Resources) []string {
+	var l []string
+
+	if r.Memory != 0 {
+		l = append(l, fmt.Sprintf("MemoryMax=%d", r.Memory))
+	}
+
+	if r.MemoryReservation != 0 {
+		l = append(l, fmt.Sprintf("MemoryLow=%d", r.MemoryReservation))
+	}
+
+	if r.CPUShares != 0 {
+		l = append(l, fmt.Sprintf("CPUWeight=%d", weight(r.CPUShares)))
+	}
+
+	if r.CPUQuota != 0 {
+		l = append(l, fmt.Sprintf("CPUQuota=%d%%", r.CPUQuota*100/r.CPUPeriod))
+	}
+
+	if r.PidsLimit != 0 {
+		l = append(l, fmt.Sprintf("TasksMax=%d", r.PidsLimit))
+	}
+
+	if r.BlkioWeight != 0 {
+		l = append(l, fmt.Sprintf("IOWeight=%d", r.BlkioWeight))
+	}
+
+	return l
+}
+
+// budget translates the group budget into directives of the group slice, so
+// that the total is enforced on top of per-shard limits.
+func budget(q Quotas) ([]string, error) {
+	var l []string
+
+	if len(q.GroupMemory) != 0 {
+		n, err := units.RAMInBytes(q.GroupMemory)
+
+		if err != nil {
+			return nil, fmt.Errorf("group memory budget: %v", err)
+		}
+
+		l = append(l, fmt.Sprintf("MemoryMax=%d", n))
+	}
+
+	if q.GroupCPUs > 0 {
+		l = append(l, fmt.Sprintf("CPUQuota=%d%%", int64(q.GroupCPUs*100)))
+	}
+
+	if q.GroupPids > 0 {
+		l = append(l, fmt.Sprintf("TasksMax=%d", q.GroupPids))
+	}
+
+	return l, nil
+}
+
+// quote formats a list of words for systemd.
+func quote(words []string, r *strings.Replacer) string {
+	l := make([]string, len(words))
+
+	for i, w := range words {
+		l[i] = `"` + r.Replace(w) + `"`
+	}
+
+	return strings.Join(l, " ")
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// ShardContext is available to container config templates. Every string in
+// the config is a text/template, e.g. "--shard-id={{.Ordinal}}".
+type ShardContext struct {
+	Group   string // Group name.
+	Ordinal int    // Shard ordinal.
+	Size    int    // Number of shards in the group.
+	CPUSet  string // Cpuset the shard is pinned to.
+	Node    int    // NUMA node, or -1 if the unit spans several nodes.
+	Weight  int    // Number of CPUs in the cpuset.
+}
+
+var templateFuncs = template.FuncMap{
+	"add": func(a, b int) int { return a + b },
+	"mul": func(a, b int) int { return a * b },
+
+	// Used for per-shard host port allocation, see parsePortSpec.
+	"port": allocate,
+}
+
+// render executes all string templates found in v, which must be a pointer.
+func render(v interface{}, ctx ShardContext) error {
+	return walk(reflect.ValueOf(v).Elem(), ctx)
+}
+
+func walk(v reflect.Value, ctx ShardContext) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return walk(v.Elem(), ctx)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Field(i).CanSet() {
+				continue
+			}
+
+			if err := walk(v.Field(i), ctx); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walk(v.Index(i), ctx); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+
+		// Map keys and elements are not addressable, so they're copied into
+		// a new map, which replaces the original one. Keys which render the
+		// same would silently overwrite each other, so they're refused.
+		m := reflect.MakeMap(v.Type())
+		from := make(map[interface{}]interface{})
+
+		for _, k := range v.MapKeys() {
+			key := reflect.New(k.Type()).Elem()
+			key.Set(k)
+
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(k))
+
+			if err := walk(key, ctx); err != nil {
+				return err
+			}
+
+			if err := walk(elem, ctx); err != nil {
+				return err
+			}
+
+			if other, ok := from[key.Interface()]; ok {
+				return fmt.Errorf("keys '%v' and '%v' both render to '%v'",
+					other, k.Interface(), key.Interface())
+			}
+
+			from[key.Interface()] = k.Interface()
+			m.SetMapIndex(key, elem)
+		}
+
+		v.Set(m)
+	case reflect.String:
+		if !strings.Contains(v.String(), "{{") {
+			return nil
+		}
+
+		t, err := template.New("config").Funcs(templateFuncs).Option(
+			"missingkey=error").Parse(v.String())
+
+		if err != nil {
+			return err
+		}
+
+		var b bytes.Buffer
+
+		if err := t.Execute(&b, ctx); err != nil {
+			return err
+		}
+
+		v.SetString(b.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package tesson
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	type nested struct {
+		Name string
+		Args []string
+	}
+
+	type settings struct {
+		Env     []string
+		Labels  map[string]string
+		Nested  *nested
+		Count   int
+		private string
+	}
+
+	ctx := ShardContext{
+		Group: "api", Ordinal: 2, Size: 4, CPUSet: "2-3", Node: 1, Weight: 2}
+
+	str := func(s string) *string { return &s }
+
+	for _, c := range []struct {
+		name string
+		v    interface{}
+		want interface{}
+		fail bool
+	}{
+		{name: "string",
+			v:    str("{{.Group}}-{{.Ordinal}}"),
+			want: "api-2"},
+		{name: "plain",
+			v:    str("api"),
+			want: "api"},
+		{name: "funcs",
+			v:    &[]string{"--id={{add .Ordinal 1}}", "--procs={{mul .Weight 4}}"},
+			want: []string{"--id=3", "--procs=8"}},
+		{name: "port",
+			v:    str("{{port 9000 9099 .Ordinal}}"),
+			want: "9002"},
+		{name: "struct",
+			v: &settings{
+				Env:     []string{"NODE={{.Node}}", "CPUS={{.CPUSet}}"},
+				Labels:  map[string]string{"shard-{{.Ordinal}}": "{{.Size}}"},
+				Nested:  &nested{Name: "{{.Group}}", Args: []string{"{{.Weight}}"}},
+				Count:   1,
+				private: "{{.Group}}"},
+			want: settings{
+				Env:     []string{"NODE=1", "CPUS=2-3"},
+				Labels:  map[string]string{"shard-2": "4"},
+				Nested:  &nested{Name: "api", Args: []string{"2"}},
+				Count:   1,
+				private: "{{.Group}}"}},
+		{name: "map keys",
+			v: &map[string]string{
+				"{{.Group}}": "{{.Ordinal}}", "shard-{{.Ordinal}}": "x", "plain": "{{.Node}}"},
+			want: map[string]string{"api": "2", "shard-2": "x", "plain": "1"}},
+		{name: "map key collision",
+			v:    &map[string]string{"shard-{{.Ordinal}}": "a", "shard-2": "b"},
+			fail: true},
+		{name: "nil pointer",
+			v:    &settings{},
+			want: settings{}},
+		{name: "port range too small",
+			v:    str("{{port 9000 9001 .Ordinal}}"),
+			fail: true},
+		{name: "unknown field",
+			v:    str("{{.Shard}}"),
+			fail: true},
+		{name: "syntax",
+			v:    str("{{.Group"),
+			fail: true},
+	} {
+		err := render(c.v, ctx)
+
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s: expected an error", c.name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		} else if v := reflect.ValueOf(c.v).Elem().Interface(); !reflect.DeepEqual(v, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.name, v, c.want)
+		}
+	}
+}
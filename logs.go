@@ -0,0 +1,209 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kobolog/tesson/lib"
+	"gopkg.in/urfave/cli.v2"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	errNoLogsSupport = errors.New("runtime doesn't support log streaming")
+)
+
+// Shard prefix colours, picked by ordinal.
+var colours = []int{31, 32, 33, 34, 35, 36}
+
+type logRecord struct {
+	Group   string    `json:"group"`
+	Ordinal int       `json:"ordinal"`
+	CPUSet  string    `json:"cpuset"`
+	ID      string    `json:"id"`
+	Stream  string    `json:"stream"`
+	Time    time.Time `json:"time"`
+	Text    string    `json:"text"`
+}
+
+func logs(c *cli.Context) error {
+	if !c.IsSet("group") {
+		return cli.ShowCommandHelp(c, "logs")
+	}
+
+	tl, ok := r.(tesson.Tailer)
+
+	if !ok {
+		return errNoLogsSupport
+	}
+
+	group := c.String("group")
+
+	i, err := r.Info(group)
+
+	if err != nil {
+		return err
+	}
+
+	var shards []tesson.Shard
+
+	for _, s := range i.Shards {
+		if c.IsSet("shard") && s.Ordinal != c.Int("shard") {
+			continue
+		}
+
+		shards = append(shards, s)
+	}
+
+	if len(shards) == 0 {
+		return fmt.Errorf("group [%s] has no shard %d", group, c.Int("shard"))
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		failed  int
+		streams = make([]chan logRecord, len(shards))
+		opts    = tesson.LogsOptions{
+			Follow: c.Bool("follow"),
+			Since:  c.String("since")}
+	)
+
+	// Lines are printed as they arrive when following, otherwise they're
+	// merged in the order they were written.
+	emit := func(i int, rec logRecord) error {
+		if !opts.Follow {
+			streams[i] <- rec
+			return nil
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		return output(c, rec)
+	}
+
+	for i, s := range shards {
+		streams[i] = make(chan logRecord, 64)
+		wg.Add(1)
+
+		go func(i int, s tesson.Shard) {
+			defer wg.Done()
+			defer close(streams[i])
+
+			err := tl.Logs(s, opts, func(l tesson.LogLine) error {
+				return emit(i, logRecord{
+					Group:   group,
+					Ordinal: s.Ordinal,
+					CPUSet:  s.Unit.String(),
+					ID:      s.ID,
+					Stream:  l.Stream,
+					Time:    l.Time,
+					Text:    l.Text})
+			})
+
+			if err != nil {
+				// Reported right away, other shards keep streaming.
+				log.Errorf("shard %d: log stream failed: %v.", s.Ordinal, err)
+
+				mu.Lock()
+				failed++
+				mu.Unlock()
+			}
+		}(i, s)
+	}
+
+	if !opts.Follow {
+		if err := merge(c, streams); err != nil {
+			return err
+		}
+	}
+
+	wg.Wait()
+
+	if failed != 0 {
+		return fmt.Errorf("%d of %d log streams failed", failed, len(shards))
+	}
+
+	return nil
+}
+
+// merge prints lines of several streams in the order they were written. It
+// relies on each stream being ordered, so that a line can be printed as soon
+// as every other stream has a later line pending or has ended.
+func merge(c *cli.Context, streams []chan logRecord) error {
+	heads := make([]*logRecord, len(streams))
+
+	for {
+		next := -1
+
+		for i, ch := range streams {
+			if heads[i] == nil && ch != nil {
+				if rec, ok := <-ch; ok {
+					heads[i] = &rec
+				} else {
+					streams[i] = nil
+				}
+			}
+
+			if heads[i] == nil {
+				continue
+			}
+
+			if next == -1 || heads[i].Time.Before(heads[next].Time) {
+				next = i
+			}
+		}
+
+		if next == -1 {
+			return nil
+		}
+
+		if err := output(c, *heads[next]); err != nil {
+			return err
+		}
+
+		heads[next] = nil
+	}
+}
+
+// output prints a log line, either as JSON or prefixed with its shard.
+func output(c *cli.Context, rec logRecord) error {
+	if c.Bool("json") {
+		return json.NewEncoder(os.Stdout).Encode(rec)
+	}
+
+	prefix := fmt.Sprintf("%d %s |", rec.Ordinal, rec.CPUSet)
+
+	if c.Bool("colour") && rec.Ordinal >= 0 {
+		prefix = fmt.Sprintf("\x1b[%dm%s\x1b[0m",
+			colours[rec.Ordinal%len(colours)], prefix)
+	}
+
+	_, err := fmt.Printf("%s %s\n", prefix, rec.Text)
+
+	return err
+}
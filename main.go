@@ -22,6 +22,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
@@ -35,12 +36,13 @@ import (
 )
 
 var (
-	t tesson.Topology
-	r tesson.RuntimeContext
+	t  tesson.Topology
+	r  tesson.RuntimeContext
+	ns tesson.Namespace
 )
 
 func exec(c *cli.Context) error {
-	if c.NArg() == 0 {
+	if c.NArg() == 0 && !c.IsSet("from-compose") {
 		return cli.ShowCommandHelp(c, "run")
 	}
 
@@ -67,38 +69,81 @@ func exec(c *cli.Context) error {
 	}
 
 	opts := tesson.ExecOptions{
-		Image:  c.Args().Get(0),
-		Layout: l,
-		Ports:  c.StringSlice("port"),
-		Config: c.String("config")}
+		Image:      c.Args().Get(0),
+		Args:       c.Args().Tail(),
+		Layout:     l,
+		Unit:       c.String("unit"),
+		Ports:      c.StringSlice("port"),
+		Config:     c.String("config"),
+		Pull:       c.String("pull"),
+		Auth:       c.String("registry-auth"),
+		Names:      c.String("names"),
+		Quotas:     quotas(c),
+		Env:        c.StringSlice("env"),
+		Volumes:    c.StringSlice("volume"),
+		Entrypoint: c.String("entrypoint"),
+		Network:    c.String("network"),
+		Labels:     c.StringSlice("label")}
 
 	var group string
 
+	if c.IsSet("from-compose") {
+		if c.IsSet("config") {
+			return errComposeWithConfig
+		}
+
+		spec, err := fromCompose(c)
+
+		if err != nil {
+			return err
+		}
+
+		if c.NArg() == 0 {
+			opts.Image = spec.Image
+		}
+
+		opts.Ports = append(spec.Ports, opts.Ports...)
+		opts.Inline = spec.Config
+		group = spec.Name
+	}
+
 	if c.IsSet("group") {
 		group = c.String("group")
-	} else {
-		group = opts.Image
+	} else if len(group) == 0 {
+		if group, err = groupName(opts.Image); err != nil {
+			return err
+		}
 	}
 
-	log.Infof("spawning %d shards, layout: %v.", len(l), l)
+	if c.IsSet("macvlan") {
+		opts.Macvlan = &tesson.MacvlanOptions{
+			Parent:  c.String("macvlan"),
+			Subnet:  c.String("subnet"),
+			Gateway: c.String("gateway"),
+			IPRange: c.String("ip-range")}
+	}
 
-	i, err := r.Exec(group, opts)
+	check, err := readiness(c.String("ready"))
 
 	if err != nil {
 		return err
 	}
 
-	if c.IsSet("gorb") {
-		f, err := tesson.NewGorbFrontend(c.String("gorb"))
+	f, err := frontend(c)
 
-		if err != nil {
-			return err
-		}
+	if err != nil {
+		return err
+	}
 
-		return f.CreateService(group, i.Shards)
+	log.Infof("spawning %d shards, layout: %v.", len(l), l)
+
+	i, err := r.Exec(group, opts)
+
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return register(group, i.Shards, f, check, c.Duration("ready-timeout"))
 }
 
 func list(c *cli.Context) error {
@@ -108,31 +153,64 @@ func list(c *cli.Context) error {
 		return err
 	}
 
+	if l, err = filter(l, c.StringSlice("filter")); err != nil {
+		return err
+	}
+
 	if len(l) == 0 {
 		return nil
 	}
 
-	if c.IsSet("json") {
+	wide := c.Bool("wide")
+
+	if wide {
+		if l, err = details(c, l); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case c.Bool("quiet"):
+		for _, g := range l {
+			for _, s := range g.Shards {
+				fmt.Println(s.ID)
+			}
+		}
+	case c.IsSet("format"):
+		return format(l, c.String("format"))
+	case c.IsSet("json"):
 		json.NewEncoder(os.Stdout).Encode(l)
-	} else {
-		tabulate(l)
+	default:
+		tabulate(l, wide)
 	}
 
 	return nil
 }
 
-func tabulate(l []tesson.Group) {
+func tabulate(l []tesson.Group, wide bool) {
 	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
 
 	for i, g := range l {
 		n, _ := fmt.Printf("Group: %s [%s]\n", g.Name, g.Image)
 		fmt.Println(strings.Repeat("-", n-1))
 
-		fmt.Fprintf(w, "INSTANCE ID\tSTATUS\tNAME\tLAYOUT\n")
+		if wide {
+			fmt.Fprintf(w, "INSTANCE ID\tORDINAL\tSTATUS\tNAME\tLAYOUT\t"+
+				"MEMS\tPORTS\tHEALTH\tFRONTEND\n")
+		} else {
+			fmt.Fprintf(w, "INSTANCE ID\tORDINAL\tSTATUS\tNAME\tLAYOUT\n")
+		}
 
 		for _, s := range g.Shards {
-			fmt.Fprintf(w, "%.8s\t%s\t%s\t%s\n", s.ID, s.Status,
-				s.Name, s.Unit)
+			fmt.Fprintf(w, "%.8s\t%s\t%s\t%s\t%s", s.ID, ordinal(s),
+				s.Status, s.Name, s.Unit)
+
+			if wide {
+				fmt.Fprintf(w, "\t%s\t%s\t%s\t%s", orNone(s.Mems),
+					orNone(ports(s)), orNone(s.Health), registered(s))
+			}
+
+			fmt.Fprintln(w)
 		}
 
 		w.Flush()
@@ -143,6 +221,14 @@ func tabulate(l []tesson.Group) {
 	}
 }
 
+func ordinal(s tesson.Shard) string {
+	if s.Ordinal < 0 {
+		return "?"
+	}
+
+	return strconv.Itoa(s.Ordinal)
+}
+
 func stop(c *cli.Context) error {
 	if !c.IsSet("group") {
 		return cli.ShowCommandHelp(c, "stop")
@@ -150,8 +236,10 @@ func stop(c *cli.Context) error {
 
 	group := c.String("group")
 
+	defer lock(c, group)()
+
 	if c.IsSet("gorb") {
-		f, err := tesson.NewGorbFrontend(c.String("gorb"))
+		f, err := tesson.NewGorbFrontend(c.String("gorb"), ns)
 
 		if err != nil {
 			return err
@@ -174,6 +262,294 @@ func stop(c *cli.Context) error {
 	})
 }
 
+func scale(c *cli.Context) error {
+	if !c.IsSet("group") || !c.IsSet("size") {
+		return cli.ShowCommandHelp(c, "scale")
+	}
+
+	group := c.String("group")
+
+	if c.Int("size") <= 0 {
+		return fmt.Errorf("group size must be positive, got %d", c.Int("size"))
+	}
+
+	defer lock(c, group)()
+
+	i, err := r.Info(group)
+
+	if err != nil {
+		return err
+	}
+
+	g, err := granularity(c.String("unit"), i)
+
+	if err != nil {
+		return err
+	}
+
+	l, err := t.Distribute(c.Int("size"), tesson.DistributeOptions{
+		Granularity: g,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	f, err := frontend(c)
+
+	if err != nil {
+		return err
+	}
+
+	return resize(group, l, f, nil, 0)
+}
+
+// resize brings a group to a new layout. New shards are registered with the
+// frontend once they are ready, if there's a readiness check.
+func resize(group string, l []tesson.Unit, f tesson.Frontend,
+	check *tesson.ReadyCheck, timeout time.Duration) error {
+
+	i, err := r.Info(group)
+
+	if err != nil {
+		return err
+	}
+
+	p := tesson.PlanLayout(i.Shards, l)
+
+	log.Infof("scaling to %d shards: %d kept, %d removed, %d created.",
+		len(l), len(p.Keep), len(p.Remove), len(p.Create))
+
+	if f != nil {
+		if err := f.RemoveBackends(group, p.Remove); err != nil {
+			return err
+		}
+	}
+
+	s, err := r.Apply(group, p, tesson.StopOptions{
+		Purge:   true,
+		Timeout: 30 * time.Second,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if len(s) == 0 {
+		return nil
+	}
+
+	return register(group, s, f, check, timeout)
+}
+
+// granularity parses the binding unit given by the user, which defaults to
+// the one the group was started with, or to cores if it's not recorded.
+func granularity(unit string, g tesson.Group) (tesson.Granularity, error) {
+	if len(unit) == 0 {
+		if unit = g.Unit; len(unit) == 0 {
+			unit = "core"
+		}
+	}
+
+	return tesson.ParseGranularity(unit)
+}
+
+func heal(c *cli.Context) error {
+	f, err := frontend(c)
+
+	if err != nil {
+		return err
+	}
+
+	var groups []string
+
+	if c.IsSet("group") {
+		groups = []string{c.String("group")}
+	} else if l, err := r.List(); err == nil {
+		for _, i := range l {
+			groups = append(groups, i.Name)
+		}
+	} else {
+		return err
+	}
+
+	for _, group := range groups {
+		unlock := lock(c, group)
+		err := restore(group, c.Int("size"), c.String("unit"), f)
+
+		unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lock takes the lock of a group until the returned function is called, so
+// that the daemon doesn't heal the group while it's being changed. Groups are
+// changed without the lock if it can't be taken, e.g. if the state dir isn't
+// writable.
+func lock(c *cli.Context, group string) func() {
+	l, err := ns.LockGroup(c.String("state-dir"), group, false)
+
+	if err == tesson.ErrGroupLocked {
+		log.Infof("group [%s] is being changed by another command, waiting.", group)
+		l, err = ns.LockGroup(c.String("state-dir"), group, true)
+	}
+
+	if err != nil {
+		log.Warnf("unable to lock group [%s]: %v.", group, err)
+		return func() {}
+	}
+
+	return func() { l.Unlock() }
+}
+
+// groupName returns the default name of a group running the image.
+func groupName(image string) (string, error) {
+	l, err := r.List()
+
+	if err != nil {
+		return "", err
+	}
+
+	return tesson.GroupName(image, l), nil
+}
+
+// restore replaces dead shards of a group and recreates missing ones. The
+// group is expected to have at least n shards, laid out by the given unit.
+func restore(group string, n int, unit string, f tesson.Frontend) error {
+	i, err := r.Info(group)
+
+	if err != nil {
+		return err
+	}
+
+	g, err := granularity(unit, i)
+
+	if err != nil {
+		return err
+	}
+
+	for _, s := range i.Shards {
+		if s.Ordinal >= n {
+			n = s.Ordinal + 1
+		}
+	}
+
+	var l []tesson.Unit
+
+	if n > 0 {
+		l, err = t.Distribute(n, tesson.DistributeOptions{
+			Granularity: g,
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	p, err := tesson.PlanRecovery(i.Shards, l)
+
+	if err != nil {
+		return err
+	}
+
+	if len(p.Create) == 0 {
+		return nil
+	}
+
+	log.Infof("healing group [%s]: %d dead, %d missing.", group,
+		len(p.Remove), len(p.Create)-len(p.Remove))
+
+	if f != nil {
+		if err := f.RemoveBackends(group, p.Remove); err != nil {
+			return err
+		}
+	}
+
+	s, err := r.Apply(group, p, tesson.StopOptions{
+		Purge:   true,
+		Timeout: 30 * time.Second,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if f != nil {
+		return f.CreateService(group, s)
+	}
+
+	return nil
+}
+
+// quotas returns resource quotas given with quotaFlags.
+func quotas(c *cli.Context) tesson.Quotas {
+	return tesson.Quotas{
+		Memory:            c.String("memory"),
+		MemoryPerCore:     c.String("memory-per-core"),
+		MemoryReservation: c.String("memory-reservation"),
+		CPUShares:         c.String("cpu-shares"),
+		GroupMemory:       c.String("group-memory"),
+		GroupCPUs:         c.Float64("group-cpus"),
+		GroupPids:         c.Int64("group-pids"),
+		GroupIOWeight:     c.Int("group-io-weight"),
+		CgroupParent:      c.String("cgroup-parent")}
+}
+
+// quotaFlags are shared by commands which spawn or describe shards.
+func quotaFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Usage: "per-shard memory `LIMIT`, or node-share to split NUMA node memory",
+			Name:  "memory",
+		},
+		&cli.StringFlag{
+			Usage: "memory `LIMIT` per core of the shard unit",
+			Name:  "memory-per-core",
+		},
+		&cli.StringFlag{
+			Usage: "memory `RESERVATION`, or a percentage of the limit",
+			Name:  "memory-reservation",
+		},
+		&cli.StringFlag{
+			Usage: "cpu `SHARES`, or weighted to scale with the unit weight",
+			Name:  "cpu-shares",
+		},
+		&cli.StringFlag{
+			Usage: "total memory `LIMIT` of the group, split among shards",
+			Name:  "group-memory",
+		},
+		&cli.Float64Flag{
+			Usage: "total `NUMBER` of cpus of the group, split among shards",
+			Name:  "group-cpus",
+		},
+		&cli.Int64Flag{
+			Usage: "total `NUMBER` of processes of the group, split among shards",
+			Name:  "group-pids",
+		},
+		&cli.IntFlag{
+			Usage: "total block io `WEIGHT` of the group, split among shards",
+			Name:  "group-io-weight",
+		},
+		&cli.StringFlag{
+			Usage: "shared parent `CGROUP` for all shards",
+			Name:  "cgroup-parent",
+		}}
+}
+
+// frontend returns the configured Frontend or nil if there's none.
+func frontend(c *cli.Context) (tesson.Frontend, error) {
+	if !c.IsSet("gorb") {
+		return nil, nil
+	}
+
+	return tesson.NewGorbFrontend(c.String("gorb"), ns)
+}
+
 func main() {
 	app := &cli.App{
 		Authors: []*cli.Author{
@@ -188,14 +564,33 @@ func main() {
 			Usage:   "Gorb connection `URI` (optional)",
 			Name:    "gorb",
 			EnvVars: []string{"GORB_URI"},
+		},
+		&cli.StringFlag{
+			Usage:   "shard runtime, either docker or process",
+			Name:    "runtime",
+			Value:   "docker",
+			EnvVars: []string{"TESSON_RUNTIME"},
+		},
+		&cli.StringFlag{
+			Usage:   "state `DIR` of the process runtime and namespaces",
+			Name:    "state-dir",
+			Value:   tesson.DefaultStateDir,
+			EnvVars: []string{"TESSON_STATE_DIR"},
+		},
+		&cli.StringFlag{
+			Usage:   "`NAMESPACE` to manage groups in",
+			Name:    "namespace",
+			EnvVars: []string{"TESSON_NAMESPACE"},
 		}}
 
+	app.Before = setup
+
 	app.Commands = []*cli.Command{
 		{
 			Usage:     "start a sharded container group",
-			ArgsUsage: "image",
+			ArgsUsage: "image [args]",
 			Name:      "run",
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.StringFlag{
 					Usage:   "sharded container group `NAME`",
 					Name:    "group",
@@ -206,11 +601,71 @@ func main() {
 					Name:    "config",
 					Aliases: []string{"c"},
 				},
+				&cli.StringFlag{
+					Usage: "compose `FILE` to take the service config from",
+					Name:  "from-compose",
+				},
+				&cli.StringFlag{
+					Usage: "compose `SERVICE` to shard",
+					Name:  "service",
+				},
+				&cli.StringFlag{
+					Usage: "container name `PATTERN`",
+					Name:  "names",
+					Value: tesson.DefaultNames,
+				},
 				&cli.StringSliceFlag{
 					Usage:   "`PORT` to publish",
 					Name:    "port",
 					Aliases: []string{"p"},
 				},
+				&cli.StringSliceFlag{
+					Usage:   "environment `VARIABLE` to set",
+					Name:    "env",
+					Aliases: []string{"e"},
+				},
+				&cli.StringSliceFlag{
+					Usage:   "`VOLUME` to bind",
+					Name:    "volume",
+					Aliases: []string{"v"},
+				},
+				&cli.StringFlag{
+					Usage: "`ENTRYPOINT` to override",
+					Name:  "entrypoint",
+				},
+				&cli.StringFlag{
+					Usage: "`NETWORK` to connect shards to",
+					Name:  "network",
+				},
+				&cli.StringSliceFlag{
+					Usage: "container `LABEL` to set",
+					Name:  "label",
+				},
+				&cli.StringFlag{
+					Usage: "readiness `CHECK`: health, tcp:PORT or http:PORT/PATH",
+					Name:  "ready",
+				},
+				&cli.DurationFlag{
+					Usage: "`DURATION` to wait for shards to become ready",
+					Name:  "ready-timeout",
+					Value: time.Minute,
+				},
+				&cli.StringFlag{
+					Usage: "attach shards to a macvlan network on the parent `DEVICE`",
+					Name:  "macvlan",
+				},
+				&cli.StringFlag{
+					Usage: "macvlan network `SUBNET`",
+					Name:  "subnet",
+				},
+				&cli.StringFlag{
+					Usage: "macvlan network `GATEWAY`",
+					Name:  "gateway",
+				},
+				&cli.StringFlag{
+					Usage: "`RANGE` to allocate shard addresses from",
+					Name:  "ip-range",
+				},
 				&cli.IntFlag{
 					Usage:   "`NUMBER` of instances",
 					Name:    "size",
@@ -222,9 +677,126 @@ func main() {
 					Aliases: []string{"u"},
 					Value:   "core",
 				},
-			},
+				&cli.StringFlag{
+					Usage: "image pull `POLICY`: missing, always or never",
+					Name:  "pull",
+					Value: tesson.PullMissing,
+				},
+				&cli.StringFlag{
+					Usage:   "registry `CREDENTIALS` as username:password",
+					Name:    "registry-auth",
+					EnvVars: []string{"TESSON_REGISTRY_AUTH"},
+				},
+			}, quotaFlags()...),
 			Action: exec,
 		},
+		{
+			Usage: "export a sharded group for other tools",
+			Name:  "export",
+			Subcommands: []*cli.Command{
+				{
+					Usage:     "generate systemd units for a sharded process group",
+					ArgsUsage: "command [args]",
+					Name:      "systemd",
+					Flags: append([]cli.Flag{
+						&cli.StringFlag{
+							Usage:   "sharded process group `NAME`",
+							Name:    "group",
+							Aliases: []string{"g"},
+						},
+						&cli.StringSliceFlag{
+							Usage:   "environment `VARIABLE` to set",
+							Name:    "env",
+							Aliases: []string{"e"},
+						},
+						&cli.IntFlag{
+							Usage:   "`NUMBER` of instances",
+							Name:    "size",
+							Aliases: []string{"n"},
+						},
+						&cli.StringFlag{
+							Usage:   "binding `UNIT`",
+							Name:    "unit",
+							Aliases: []string{"u"},
+							Value:   "core",
+						},
+						&cli.StringFlag{
+							Usage:   "output `DIR` for unit files",
+							Name:    "output",
+							Aliases: []string{"o"},
+							Value:   ".",
+						},
+					}, quotaFlags()...),
+					Action: exportSystemd,
+				},
+				{
+					Usage:     "generate a compose file for a sharded container group",
+					ArgsUsage: "[image [args]]",
+					Name:      "compose",
+					Flags: append([]cli.Flag{
+						&cli.StringFlag{
+							Usage:   "sharded container group `NAME`",
+							Name:    "group",
+							Aliases: []string{"g"},
+						},
+						&cli.StringFlag{
+							Usage:   "container config `FILE`",
+							Name:    "config",
+							Aliases: []string{"c"},
+						},
+						&cli.StringFlag{
+							Usage: "container name `PATTERN`",
+							Name:  "names",
+							Value: tesson.DefaultNames,
+						},
+						&cli.StringSliceFlag{
+							Usage:   "`PORT` to publish",
+							Name:    "port",
+							Aliases: []string{"p"},
+						},
+						&cli.StringSliceFlag{
+							Usage:   "environment `VARIABLE` to set",
+							Name:    "env",
+							Aliases: []string{"e"},
+						},
+						&cli.StringSliceFlag{
+							Usage:   "`VOLUME` to bind",
+							Name:    "volume",
+							Aliases: []string{"v"},
+						},
+						&cli.StringFlag{
+							Usage: "`ENTRYPOINT` to override",
+							Name:  "entrypoint",
+						},
+						&cli.StringFlag{
+							Usage: "`NETWORK` to connect shards to",
+							Name:  "network",
+						},
+						&cli.StringSliceFlag{
+							Usage: "container `LABEL` to set",
+							Name:  "label",
+						},
+						&cli.IntFlag{
+							Usage:   "`NUMBER` of instances",
+							Name:    "size",
+							Aliases: []string{"n"},
+						},
+						&cli.StringFlag{
+							Usage:   "binding `UNIT`",
+							Name:    "unit",
+							Aliases: []string{"u"},
+							Value:   "core",
+						},
+						&cli.StringFlag{
+							Usage:   "output `FILE`, stdout by default",
+							Name:    "output",
+							Aliases: []string{"o"},
+						},
+					}, quotaFlags()...),
+					Action: exportCompose,
+				},
+			},
+		},
 		{
 			Usage: "list all sharded container groups",
 			Name:  "ps",
@@ -233,6 +805,25 @@ func main() {
 					Usage: "format output as json",
 					Name:  "json",
 				},
+				&cli.StringSliceFlag{
+					Usage:   "filter shards by `KEY=VALUE`: group, image, state or node",
+					Name:    "filter",
+					Aliases: []string{"f"},
+				},
+				&cli.StringFlag{
+					Usage: "format shards using a Go `TEMPLATE`",
+					Name:  "format",
+				},
+				&cli.BoolFlag{
+					Usage:   "show ports, mems, health and frontend status",
+					Name:    "wide",
+					Aliases: []string{"w"},
+				},
+				&cli.BoolFlag{
+					Usage:   "only show shard IDs",
+					Name:    "quiet",
+					Aliases: []string{"q"},
+				},
 			},
 			Action: list,
 		},
@@ -251,6 +842,241 @@ func main() {
 				},
 			},
 			Action: stop,
+		},
+		{
+			Usage: "resize a sharded container group",
+			Name:  "scale",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Usage:   "sharded container group `NAME`",
+					Name:    "group",
+					Aliases: []string{"g"},
+				},
+				&cli.IntFlag{
+					Usage:   "new `NUMBER` of instances",
+					Name:    "size",
+					Aliases: []string{"n"},
+				},
+				&cli.StringFlag{
+					Usage:   "binding `UNIT`, the one the group was started with by default",
+					Name:    "unit",
+					Aliases: []string{"u"},
+				},
+			},
+			Action: scale,
+		},
+		{
+			Usage: "recreate dead or missing shards",
+			Name:  "heal",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Usage:   "sharded container group `NAME`, all if omitted",
+					Name:    "group",
+					Aliases: []string{"g"},
+				},
+				&cli.IntFlag{
+					Usage:   "expected `NUMBER` of instances",
+					Name:    "size",
+					Aliases: []string{"n"},
+				},
+				&cli.StringFlag{
+					Usage:   "binding `UNIT`, the one the group was started with by default",
+					Name:    "unit",
+					Aliases: []string{"u"},
+				},
+			},
+			Action: heal,
+		},
+		{
+			Usage: "follow runtime events and keep the frontend up to date",
+			Name:  "daemon",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Usage: "recreate dead shards",
+					Name:  "heal",
+				},
+				&cli.DurationFlag{
+					Usage: "wait for `DELAY` before healing a group",
+					Name:  "heal-delay",
+					Value: 10 * time.Second,
+				},
+			},
+			Action: daemon,
+		},
+		{
+			Usage: "bring sharded container groups in line with a spec",
+			Name:  "apply",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Usage:   "group spec `FILE` in YAML or JSON format",
+					Name:    "file",
+					Aliases: []string{"f"},
+				},
+				&cli.StringFlag{
+					Usage: "compose `FILE` to take the service config from",
+					Name:  "from-compose",
+				},
+				&cli.StringFlag{
+					Usage: "compose `SERVICE` to shard",
+					Name:  "service",
+				},
+				&cli.BoolFlag{
+					Usage: "only show what would be done",
+					Name:  "dry-run",
+				},
+				&cli.StringFlag{
+					Usage: "image pull `POLICY`: missing, always or never",
+					Name:  "pull",
+					Value: tesson.PullMissing,
+				},
+				&cli.StringFlag{
+					Usage:   "registry `CREDENTIALS` as username:password",
+					Name:    "registry-auth",
+					EnvVars: []string{"TESSON_REGISTRY_AUTH"},
+				},
+				&cli.DurationFlag{
+					Usage: "`DURATION` to wait for shards to become ready",
+					Name:  "ready-timeout",
+					Value: time.Minute,
+				},
+			},
+			Action: apply,
+		},
+		{
+			Usage: "show differences between the desired and actual state of groups",
+			Name:  "diff",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Usage:   "sharded container group `NAME`",
+					Name:    "group",
+					Aliases: []string{"g"},
+				},
+				&cli.StringFlag{
+					Usage:   "group spec `FILE` in YAML or JSON format",
+					Name:    "file",
+					Aliases: []string{"f"},
+				},
+				&cli.StringFlag{
+					Usage: "compose `FILE` to take the service config from",
+					Name:  "from-compose",
+				},
+				&cli.StringFlag{
+					Usage: "compose `SERVICE` to shard",
+					Name:  "service",
+				},
+			},
+			Action: diff,
+		},
+		{
+			Usage: "show merged logs of all shards in a group",
+			Name:  "logs",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Usage:   "sharded container group `NAME`",
+					Name:    "group",
+					Aliases: []string{"g"},
+				},
+				&cli.BoolFlag{
+					Usage:   "follow log output",
+					Name:    "follow",
+					Aliases: []string{"f"},
+				},
+				&cli.StringFlag{
+					Usage: "show logs since `TIME`, a timestamp or a relative duration",
+					Name:  "since",
+				},
+				&cli.IntFlag{
+					Usage: "only show logs of the shard with the given `ORDINAL`",
+					Name:  "shard",
+				},
+				&cli.BoolFlag{
+					Usage:   "colour-code shard prefixes",
+					Name:    "colour",
+					Aliases: []string{"color"},
+				},
+				&cli.BoolFlag{
+					Usage: "format output as json lines",
+					Name:  "json",
+				},
+			},
+			Action: logs,
+		},
+		{
+			Usage:     "run a command in every shard of a group",
+			ArgsUsage: "-- command [args]",
+			Name:      "exec",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Usage:   "sharded container group `NAME`",
+					Name:    "group",
+					Aliases: []string{"g"},
+				},
+				&cli.BoolFlag{
+					Usage: "run in all shards at once",
+					Name:  "parallel",
+				},
+			},
+			Action: execute,
+		},
+		{
+			Usage: "show resource usage of shards",
+			Name:  "stats",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Usage:   "sharded container group `NAME`",
+					Name:    "group",
+					Aliases: []string{"g"},
+				},
+				&cli.BoolFlag{
+					Usage: "print a single sample instead of streaming",
+					Name:  "no-stream",
+				},
+			},
+			Action: stats,
+		},
+		{
+			Usage:     "take over pinned containers started by hand",
+			ArgsUsage: "container [container...]",
+			Name:      "adopt",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Usage:   "sharded container group `NAME`",
+					Name:    "group",
+					Aliases: []string{"g"},
+				},
+				&cli.BoolFlag{
+					Usage: "keep replaced containers instead of removing them",
+					Name:  "keep",
+				},
+			},
+			Action: adopt,
+		},
+		{
+			Usage: "show detailed state of a sharded container group",
+			Name:  "inspect",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Usage:   "sharded container group `NAME`",
+					Name:    "group",
+					Aliases: []string{"g"},
+				},
+				&cli.BoolFlag{
+					Usage: "format output as json",
+					Name:  "json",
+				},
+			},
+			Action: inspect,
+		},
+		{
+			Usage: "show or set the cpu cap of the namespace",
+			Name:  "namespace",
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Usage: "maximum `NUMBER` of cpus for all shards, 0 for unlimited",
+					Name:  "cpus",
+				},
+			},
+			Action: namespace,
 		}}
 
 	if err := app.Run(os.Args); err != nil {
@@ -266,10 +1092,27 @@ func init() {
 	if err != nil {
 		log.Fatalf("topo: %v.", err)
 	}
+}
 
-	r, err = tesson.NewDockerContext(context.Background())
+func setup(c *cli.Context) error {
+	var err error
+
+	if ns, err = tesson.LoadNamespace(c.String("state-dir"), c.String("namespace")); err != nil {
+		return err
+	}
+
+	switch c.String("runtime") {
+	case "docker":
+		r, err = tesson.NewDockerContext(context.Background(), ns)
+	case "process":
+		r, err = tesson.NewProcessContext(t, c.String("state-dir"), ns)
+	default:
+		return fmt.Errorf("unknown runtime: %s", c.String("runtime"))
+	}
 
 	if err != nil {
 		log.Fatalf("exec: %v.", err)
 	}
+
+	return nil
 }
@@ -0,0 +1,79 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"gopkg.in/urfave/cli.v2"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// namespace shows the cpu cap of the namespace along with the usage, or sets
+// the cap. The cap is recorded in the state dir, so that it applies to all
+// commands run in the namespace.
+func namespace(c *cli.Context) error {
+	if c.IsSet("cpus") {
+		ns.CPUs = c.Int("cpus")
+
+		if err := ns.Save(c.String("state-dir")); err != nil {
+			return err
+		}
+
+		log.Infof("namespace cpu cap set: %d.", ns.CPUs)
+
+		return nil
+	}
+
+	l, err := r.List()
+
+	if err != nil {
+		return err
+	}
+
+	used := 0
+
+	for _, g := range l {
+		for _, shard := range g.Shards {
+			if shard.Live() {
+				used += shard.Unit.Weight()
+			}
+		}
+	}
+
+	name, limit := ns.Name, "unlimited"
+
+	if len(name) == 0 {
+		name = "(default)"
+	}
+
+	if ns.CPUs != 0 {
+		limit = fmt.Sprint(ns.CPUs)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+
+	fmt.Fprintf(w, "NAMESPACE\tCPUS\tUSED\n")
+	fmt.Fprintf(w, "%s\t%s\t%d\n", name, limit, used)
+
+	return w.Flush()
+}
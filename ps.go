@@ -0,0 +1,191 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/kobolog/tesson/lib"
+	"gopkg.in/urfave/cli.v2"
+)
+
+// filter keeps shards matching all filters, given as "key=value". Group and
+// image names might be glob patterns. Groups with no shards left are dropped.
+func filter(l []tesson.Group, filters []string) ([]tesson.Group, error) {
+	type predicate func(g tesson.Group, s tesson.Shard) bool
+
+	var preds []predicate
+
+	for _, f := range filters {
+		p := strings.SplitN(f, "=", 2)
+
+		if len(p) != 2 {
+			return nil, fmt.Errorf("filter must be 'key=value': %s", f)
+		}
+
+		v := p[1]
+
+		switch p[0] {
+		case "group":
+			preds = append(preds, func(g tesson.Group, s tesson.Shard) bool {
+				ok, _ := path.Match(v, g.Name)
+				return ok
+			})
+		case "image":
+			preds = append(preds, func(g tesson.Group, s tesson.Shard) bool {
+				ok, _ := path.Match(v, g.Image)
+				return ok
+			})
+		case "state":
+			preds = append(preds, func(g tesson.Group, s tesson.Shard) bool {
+				return s.State == v
+			})
+		case "node":
+			preds = append(preds, func(g tesson.Group, s tesson.Shard) bool {
+				return s.Unit != nil && strconv.Itoa(s.Unit.Node()) == v
+			})
+		default:
+			return nil, fmt.Errorf("unknown filter '%s'", p[0])
+		}
+	}
+
+	var r []tesson.Group
+
+	for _, g := range l {
+		var shards []tesson.Shard
+
+	next:
+		for _, s := range g.Shards {
+			for _, pred := range preds {
+				if !pred(g, s) {
+					continue next
+				}
+			}
+
+			shards = append(shards, s)
+		}
+
+		if len(shards) != 0 {
+			g.Shards = shards
+			r = append(r, g)
+		}
+	}
+
+	return r, nil
+}
+
+// details fills in detailed shard state and frontend registrations, if the
+// runtime and the frontend support it.
+func details(c *cli.Context, l []tesson.Group) ([]tesson.Group, error) {
+	f, err := frontend(c)
+
+	if err != nil {
+		return nil, err
+	}
+
+	in, _ := r.(tesson.Inspector)
+	reg, _ := f.(tesson.Registry)
+
+	for i, g := range l {
+		if in != nil {
+			d, err := in.Inspect(g.Name)
+
+			if err != nil {
+				return nil, err
+			}
+
+			// Keeps the filtered shard list.
+			byID := make(map[string]tesson.Shard)
+
+			for _, s := range d.Shards {
+				byID[s.ID] = s
+			}
+
+			for j, s := range g.Shards {
+				if v, ok := byID[s.ID]; ok {
+					g.Shards[j] = v
+				}
+			}
+		}
+
+		if reg != nil {
+			m, err := reg.Backends(g.Name, g.Shards)
+
+			if err != nil {
+				return nil, err
+			}
+
+			for j, s := range g.Shards {
+				// Non-nil to tell unregistered shards from unknown ones.
+				g.Shards[j].Backends = append([]string{}, m[s.ID]...)
+			}
+		}
+
+		l[i] = g
+	}
+
+	return l, nil
+}
+
+// registered describes frontend registration status of a shard.
+func registered(s tesson.Shard) string {
+	switch {
+	case s.Backends == nil:
+		return "-" // Unknown.
+	case len(s.Backends) == 0:
+		return "none"
+	}
+
+	return fmt.Sprintf("%d backends", len(s.Backends))
+}
+
+// format prints each shard using a template. Shard fields are available,
+// along with .Group and .Image.
+func format(l []tesson.Group, text string) error {
+	t, err := template.New("format").Parse(text)
+
+	if err != nil {
+		return err
+	}
+
+	type row struct {
+		tesson.Shard
+		Group string
+		Image string
+	}
+
+	for _, g := range l {
+		for _, s := range g.Shards {
+			if err := t.Execute(
+				os.Stdout, row{Shard: s, Group: g.Name, Image: g.Image},
+			); err != nil {
+				return err
+			}
+
+			fmt.Println()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kobolog/tesson/lib"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var (
+	errNoProbeSupport = errors.New("runtime doesn't support readiness checks")
+)
+
+// register adds shards to the frontend. If a readiness check is given, each
+// shard is only added once it's ready; f might be nil, in which case shards
+// are just waited for.
+func register(group string, shards []tesson.Shard, f tesson.Frontend,
+	check *tesson.ReadyCheck, timeout time.Duration) error {
+
+	if check == nil {
+		if f == nil {
+			return nil
+		}
+
+		return f.CreateService(group, shards)
+	}
+
+	p, ok := r.(tesson.Prober)
+
+	if !ok {
+		return errNoProbeSupport
+	}
+
+	log.Infof("waiting for %d shards to become ready.", len(shards))
+
+	fn := func(s tesson.Shard) error {
+		log.Infof("shard %d is ready: %.12s.", s.Ordinal, s.ID)
+
+		if f == nil {
+			return nil
+		}
+
+		return f.CreateService(group, []tesson.Shard{s})
+	}
+
+	l, err := tesson.WaitReady(p, shards, *check, timeout, fn)
+
+	if err != nil {
+		return err
+	}
+
+	n := 0
+
+	for _, v := range l {
+		if !v.Ready {
+			n++
+		}
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+
+	fmt.Fprintf(w, "INSTANCE ID\tORDINAL\tREADY\tREASON\n")
+
+	for _, v := range l {
+		fmt.Fprintf(w, "%.8s\t%s\t%t\t%s\n", v.Shard.ID, ordinal(v.Shard),
+			v.Ready, v.Reason)
+	}
+
+	w.Flush()
+
+	return fmt.Errorf("group [%s]: %d of %d shards are not ready after %v",
+		group, n, len(l), timeout)
+}
+
+// readiness parses the readiness check flag, nil means no gating.
+func readiness(spec string) (*tesson.ReadyCheck, error) {
+	if len(spec) == 0 {
+		return nil, nil
+	}
+
+	check, err := tesson.ParseReadyCheck(spec)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &check, nil
+}
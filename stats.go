@@ -0,0 +1,305 @@
+// Copyright (c) 2016 Andrey Sibiryov <me@kobology.ru>
+// Copyright (c) 2016 Other contributors as noted in the AUTHORS file.
+//
+// This file is part of Tesson.
+//
+// Tesson is free software; you can redistribute it and/or modify it under the
+// terms of the GNU Lesser General Public License as published by the Free
+// Software Foundation; either version 3 of the License, or (at your option)
+// any later version.
+//
+// Tesson is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU Lesser General Public License for more
+// details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/kobolog/tesson/lib"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var (
+	errNoStatsSupport = errors.New("runtime doesn't support resource usage stats")
+)
+
+// Shards with CPU usage per unit CPU this far from the group mean, relative
+// to the mean, are flagged as imbalanced. Idle groups are never flagged.
+const (
+	imbalanceFactor = 0.5
+	idleThreshold   = 1.0 // Percent.
+)
+
+const statsInterval = 2 * time.Second
+
+func stats(c *cli.Context) error {
+	m, ok := r.(tesson.Monitor)
+
+	if !ok {
+		return errNoStatsSupport
+	}
+
+	var groups []tesson.Group
+
+	if c.IsSet("group") {
+		i, err := r.Info(c.String("group"))
+
+		if err != nil {
+			return err
+		}
+
+		groups = append(groups, i)
+	} else {
+		l, err := r.List()
+
+		if err != nil {
+			return err
+		}
+
+		groups = l
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		stream = !c.Bool("no-stream")
+		latest = make(map[string]tesson.Usage)
+		errs   = make(chan error, 1)
+		done   = make(chan struct{})
+	)
+
+	for _, g := range groups {
+		for _, s := range g.Shards {
+			if s.Dead() {
+				continue
+			}
+
+			wg.Add(1)
+
+			go func(s tesson.Shard) {
+				defer wg.Done()
+
+				if err := m.Stats(s, stream, func(u tesson.Usage) error {
+					mu.Lock()
+					defer mu.Unlock()
+
+					latest[s.ID] = u
+
+					return nil
+				}); err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+				}
+			}(s)
+		}
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	if !stream {
+		<-done
+
+		select {
+		case err := <-errs:
+			return err
+		default:
+		}
+
+		render(os.Stdout, groups, latest)
+
+		return nil
+	}
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			mu.Lock()
+			fmt.Print("\x1b[H\x1b[2J") // Clear the screen.
+			render(os.Stdout, groups, latest)
+			mu.Unlock()
+		case err := <-errs:
+			return err
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// total accumulates usage of several shards.
+type total struct {
+	cpu, throttled float64
+	mem, limit     uint64
+	rx, tx, rd, wr uint64
+	n              int
+}
+
+func (t *total) add(u tesson.Usage) {
+	t.cpu += u.CPU
+	t.throttled += u.Throttled
+	t.mem += u.Memory
+	t.limit += u.MemoryLimit
+	t.rx, t.tx = t.rx+u.NetRx, t.tx+u.NetTx
+	t.rd, t.wr = t.rd+u.BlkRead, t.wr+u.BlkWrite
+	t.n++
+}
+
+func (t *total) columns() string {
+	throttled := 0.0
+
+	if t.n > 0 {
+		throttled = t.throttled / float64(t.n)
+	}
+
+	return fmt.Sprintf("%.2f%%\t%.2f%%\t%s / %s\t%s / %s\t%s / %s",
+		t.cpu, throttled,
+		units.BytesSize(float64(t.mem)), units.BytesSize(float64(t.limit)),
+		units.HumanSize(float64(t.rx)), units.HumanSize(float64(t.tx)),
+		units.HumanSize(float64(t.rd)), units.HumanSize(float64(t.wr)))
+}
+
+// render prints usage per shard, with subtotals per NUMA node, per socket
+// and per group.
+func render(
+	out io.Writer, groups []tesson.Group, latest map[string]tesson.Usage) {
+
+	w := tabwriter.NewWriter(out, 0, 8, 1, '\t', 0)
+
+	for i, g := range groups {
+		var (
+			group   total
+			nodes   = make(map[int]*total)
+			sockets = make(map[int]*total)
+		)
+
+		n, _ := fmt.Fprintf(out, "Group: %s [%s]\n", g.Name, g.Image)
+		fmt.Fprintln(out, strings.Repeat("-", n-1))
+
+		fmt.Fprintf(w, "INSTANCE ID\tORDINAL\tLAYOUT\tCPU %%\tTHROTTLED\t"+
+			"MEM USAGE / LIMIT\tNET I/O\tBLOCK I/O\tBALANCE\n")
+
+		mean := balance(g, latest)
+
+		for _, s := range g.Shards {
+			u, ok := latest[s.ID]
+
+			if !ok {
+				fmt.Fprintf(w, "%.8s\t%s\t%s\t-\t-\t-\t-\t-\t%s\n",
+					s.ID, ordinal(s), s.Unit, s.State)
+				continue
+			}
+
+			var t total
+			t.add(u)
+			group.add(u)
+
+			if nodes[s.Unit.Node()] == nil {
+				nodes[s.Unit.Node()] = &total{}
+			}
+
+			if sockets[s.Unit.Socket()] == nil {
+				sockets[s.Unit.Socket()] = &total{}
+			}
+
+			nodes[s.Unit.Node()].add(u)
+			sockets[s.Unit.Socket()].add(u)
+
+			fmt.Fprintf(w, "%.8s\t%s\t%s\t%s\t%s\n", s.ID, ordinal(s),
+				s.Unit, t.columns(), imbalance(u, s.Unit.Weight(), mean))
+		}
+
+		subtotals(w, "node", nodes)
+		subtotals(w, "socket", sockets)
+
+		fmt.Fprintf(w, "total\t\t\t%s\t\n", group.columns())
+
+		w.Flush()
+
+		if i < len(groups)-1 {
+			fmt.Fprintln(out)
+		}
+	}
+}
+
+func subtotals(w io.Writer, kind string, m map[int]*total) {
+	var keys []int
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Ints(keys)
+
+	for _, k := range keys {
+		name := fmt.Sprintf("%s %d", kind, k)
+
+		if k < 0 {
+			name = fmt.Sprintf("%s ?", kind) // Units spanning several.
+		}
+
+		fmt.Fprintf(w, "%s\t\t\t%s\t\n", name, m[k].columns())
+	}
+}
+
+// balance returns the mean CPU usage per unit CPU across a group.
+func balance(g tesson.Group, latest map[string]tesson.Usage) float64 {
+	var (
+		sum float64
+		n   int
+	)
+
+	for _, s := range g.Shards {
+		if u, ok := latest[s.ID]; ok && s.Unit.Weight() > 0 {
+			sum += u.CPU / float64(s.Unit.Weight())
+			n++
+		}
+	}
+
+	if n == 0 {
+		return 0
+	}
+
+	return sum / float64(n)
+}
+
+// imbalance flags shards with load far from the group mean.
+func imbalance(u tesson.Usage, weight int, mean float64) string {
+	if mean < idleThreshold || weight == 0 {
+		return ""
+	}
+
+	load := u.CPU / float64(weight)
+
+	if math.Abs(load-mean) <= imbalanceFactor*mean {
+		return ""
+	}
+
+	if load > mean {
+		return "high"
+	}
+
+	return "low"
+}